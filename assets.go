@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// staticDir holds the files served under /public
+const staticDir = "public"
+
+// immutableCacheControl is sent with fingerprinted assets, whose content can
+// never change at the same address
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// revalidateCacheControl is sent with static files at their plain address,
+// which keeps the same name across edits, so caches check the ETag each time
+const revalidateCacheControl = "public, no-cache"
+
+// AssetManifest maps static files to content-hashed names, so templates can
+// link to an address that changes whenever the file does
+type AssetManifest struct {
+	// hashed maps a file's path under public/ to its fingerprinted path
+	hashed map[string]string
+	// sources maps a fingerprinted path back to the file it names
+	sources map[string]string
+}
+
+var assets atomic.Pointer[AssetManifest]
+
+// fingerprintBytes is how much of the content hash goes into a file name
+const fingerprintBytes = 6
+
+// fingerprint inserts a short content hash before the file extension:
+// style.css becomes style.1a2b3c4d5e6f.css
+func fingerprint(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:fingerprintBytes]) + ext
+}
+
+// buildAssetManifest hashes every file under dir in the site files, skipping
+// the precompressed siblings written by the precompress command
+func buildAssetManifest(dir string) (*AssetManifest, error) {
+	manifest := &AssetManifest{hashed: map[string]string{}, sources: map[string]string{}}
+	err := fs.WalkDir(siteFS, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := path.Ext(name); ext == ".br" || ext == ".gz" {
+			return nil
+		}
+		data, err := fs.ReadFile(siteFS, name)
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(name, dir+"/")
+		hashed := fingerprint(rel, data)
+		manifest.hashed[rel] = hashed
+		manifest.sources[hashed] = rel
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	return manifest, err
+}
+
+// loadAssets rebuilds the asset manifest from the static directory
+func loadAssets() error {
+	manifest, err := buildAssetManifest(staticDir)
+	if err != nil {
+		return err
+	}
+	assets.Store(manifest)
+	log.Printf("Fingerprinted %d static files in %s/", len(manifest.hashed), staticDir)
+	return nil
+}
+
+// assetPath is the "asset" template function. It resolves a file under
+// public/ to its fingerprinted address, falling back to the plain address for
+// files it does not know.
+func assetPath(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if manifest := assets.Load(); manifest != nil {
+		if hashed, ok := manifest.hashed[name]; ok {
+			return "/" + staticDir + "/" + hashed
+		}
+	}
+	log.Printf("Unknown asset %q, linking it without a fingerprint", name)
+	return "/" + staticDir + "/" + name
+}
+
+// assetFingerprint returns the fingerprinted path of a file under public/
+func assetFingerprint(name string) (string, bool) {
+	manifest := assets.Load()
+	if manifest == nil {
+		return "", false
+	}
+	hashed, ok := manifest.hashed[name]
+	return hashed, ok
+}
+
+// fingerprintETag returns a strong entity tag made from the content hash in
+// a fingerprinted path
+func fingerprintETag(hashed string) string {
+	stem := strings.TrimSuffix(hashed, path.Ext(hashed))
+	return `"` + stem[len(stem)-2*fingerprintBytes:] + `"`
+}
+
+// assetSource returns the file a fingerprinted path names, relative to
+// public/
+func assetSource(name string) (string, bool) {
+	manifest := assets.Load()
+	if manifest == nil {
+		return "", false
+	}
+	source, ok := manifest.sources[name]
+	return source, ok
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorsFile is the hand-maintained author registry
+const authorsFile = "authors.json"
+
+// Author is a writer listed in the registry. Posts reference an author by
+// slug or by name.
+type Author struct {
+	Slug   string       `json:"slug"`
+	Name   string       `json:"name"`
+	Bio    string       `json:"bio"`
+	Avatar string       `json:"avatar"`
+	Links  []AuthorLink `json:"links"`
+}
+
+// AuthorLink is a social or personal link shown on the author page
+type AuthorLink struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// URL returns the author page address
+func (a Author) URL() string {
+	return fmt.Sprintf("%s/author/%s", siteURL, url.PathEscape(a.Slug))
+}
+
+// Initials abbreviates the name for the avatar placeholder
+func (a Author) Initials() string {
+	var initials []rune
+	for _, word := range strings.Fields(a.Name) {
+		if r := []rune(word)[0]; unicode.IsLetter(r) && len(initials) < 2 {
+			initials = append(initials, unicode.ToUpper(r))
+		}
+	}
+	return string(initials)
+}
+
+// TwitterHandle returns the @handle from a Twitter or X link, if any
+func (a Author) TwitterHandle() string {
+	for _, link := range a.Links {
+		u, err := url.Parse(link.URL)
+		if err != nil {
+			continue
+		}
+		host := strings.TrimPrefix(u.Hostname(), "www.")
+		if host == "twitter.com" || host == "x.com" {
+			if handle := strings.Trim(u.Path, "/"); handle != "" && !strings.Contains(handle, "/") {
+				return "@" + handle
+			}
+		}
+	}
+	return ""
+}
+
+// loadAuthors reads the author registry. A missing file is not an error, as
+// authors are also derived from the posts themselves.
+func loadAuthors(path string) ([]Author, error) {
+	data, err := fs.ReadFile(siteFS, path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var authors []Author
+	if err := json.Unmarshal(data, &authors); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i, author := range authors {
+		if author.Name == "" {
+			return nil, fmt.Errorf("%s: author %d has no name", path, i+1)
+		}
+		// Explicit slugs are normalised like derived ones, as lookups are
+		authors[i].Slug = slugify(author.Slug)
+		if authors[i].Slug == "" {
+			authors[i].Slug = slugify(author.Name)
+		}
+		if seen[authors[i].Slug] {
+			return nil, fmt.Errorf("%s: duplicate author slug %q", path, authors[i].Slug)
+		}
+		seen[authors[i].Slug] = true
+	}
+	return authors, nil
+}
+
+// authorPageData prepares author.html data for one page of an author's posts
+func authorPageData(snap *ContentSnapshot, author Author, posts []Post, number int) map[string]interface{} {
+	page := newPage(number, postsPerPage, len(posts))
+	title := fmt.Sprintf("%s - CodeNPixel", author.Name)
+	if page.Number > 1 {
+		title = fmt.Sprintf("%s - Page %d - CodeNPixel", author.Name, page.Number)
+	}
+	description := author.Bio
+	if description == "" {
+		description = fmt.Sprintf("Articles by %s on game development and graphics programming at CodeNPixel.", author.Name)
+	}
+	pagePath := "/author/" + url.PathEscape(author.Slug)
+
+	data := map[string]interface{}{
+		"Author":      author,
+		"Posts":       postCardsData(snap, paginate(posts, page)),
+		"Page":        page,
+		"TITLE":       title,
+		"DESCRIPTION": description,
+		"KEYWORDS":    "game development, graphics programming, " + author.Name,
+		"OG_TYPE":     "profile",
+		"URL":         author.URL(),
+		"OG_IMAGE":    siteURL + "/public/images/logo.png",
+		"AUTHOR":      author.Name,
+		"JSON_LD": map[string]interface{}{
+			"@context":   "https://schema.org",
+			"@type":      "ProfilePage",
+			"mainEntity": authorJSONLD(author),
+		},
+	}
+	if author.Avatar != "" {
+		data["OG_IMAGE"] = absoluteURL(author.Avatar)
+	}
+	if handle := author.TwitterHandle(); handle != "" {
+		data["TWITTER_CREATOR"] = handle
+	}
+	if page.HasPrev() {
+		data["PrevURL"] = fmt.Sprintf("%s?page=%d", pagePath, page.Prev())
+		if page.Prev() == 1 {
+			data["PrevURL"] = pagePath
+		}
+	}
+	if page.HasNext() {
+		data["NextURL"] = fmt.Sprintf("%s?page=%d", pagePath, page.Next())
+	}
+	return data
+}
+
+// authorJSONLD describes an author as a schema.org Person
+func authorJSONLD(author Author) map[string]interface{} {
+	person := map[string]interface{}{
+		"@type": "Person",
+		"name":  author.Name,
+		"url":   author.URL(),
+	}
+	if author.Bio != "" {
+		person["description"] = author.Bio
+	}
+	if author.Avatar != "" {
+		person["image"] = absoluteURL(author.Avatar)
+	}
+	if len(author.Links) > 0 {
+		sameAs := make([]string, len(author.Links))
+		for i, link := range author.Links {
+			sameAs[i] = link.URL
+		}
+		person["sameAs"] = sameAs
+	}
+	return person
+}
+
+// absoluteURL prefixes site-relative paths with siteURL
+func absoluteURL(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return siteURL + path
+	}
+	return path
+}
+
+// handleAuthor serves /author/:slug with the author's profile and posts
+func handleAuthor(c *gin.Context) {
+	snap := requestSnapshot(c)
+	author, ok := snap.Author(c.Param("slug"))
+	posts := snap.PostsByAuthor(c.Param("slug"))
+	number, _, err := parsePage(c, postsPerPage, postsPerPage)
+	if !ok || len(posts) == 0 || err != nil {
+		renderPage(c, http.StatusNotFound, "not_found", map[string]interface{}{
+			"Icon":        "✍️",
+			"Title":       "Author Not Found",
+			"Message":     "We couldn't find that author.",
+			"ButtonText":  "Browse All Posts",
+			"IsPost":      true,
+			"TITLE":       "Author Not Found - CodeNPixel",
+			"DESCRIPTION": "The requested author was not found.",
+			"KEYWORDS":    "game development, graphics programming",
+			"OG_TYPE":     "website",
+			"URL":         siteURL + c.Request.URL.Path,
+			"OG_IMAGE":    siteURL + "/public/images/logo.png",
+		})
+		return
+	}
+
+	data := authorPageData(snap, author, posts, number)
+	if c.GetHeader("HX-Target") == "load-more" {
+		content, err := renderTemplate(snap.Templates(), "posts_page", data)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Error loading posts")
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
+		return
+	}
+	renderPage(c, http.StatusOK, "author.html", data)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadAuthors(t *testing.T) {
+	useTestSite(t, fstest.MapFS{authorsFile: {Data: []byte(`[
+		{"slug": "JaneDoe", "name": "Jane Doe"},
+		{"name": "Sam Roe"}
+	]`)}})
+	authors, err := loadAuthors(authorsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authors) != 2 || authors[0].Slug != "janedoe" || authors[1].Slug != "sam-roe" {
+		t.Fatalf("loadAuthors() = %+v, want slugs janedoe and sam-roe", authors)
+	}
+
+	date := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	snap := NewContentStore([]Post{
+		{Slug: "by-slug", Title: "By Slug", Author: "JaneDoe", Date: date, Status: StatusPublished},
+		{Slug: "by-name", Title: "By Name", Author: "jane doe", Date: date, Status: StatusPublished},
+	}, authors, Taxonomy{}, nil).Snapshot()
+	for _, slug := range []string{"janedoe", "JaneDoe"} {
+		if author, ok := snap.Author(slug); !ok || author.Name != "Jane Doe" {
+			t.Errorf("Author(%q) = %+v, %v", slug, author, ok)
+		}
+	}
+	if posts := snap.PostsByAuthor("janedoe"); len(posts) != 2 {
+		t.Errorf("PostsByAuthor(janedoe) = %d posts, want 2", len(posts))
+	}
+}
+
+func TestLoadAuthorsErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing name":                `[{"slug": "x"}]`,
+		"duplicate after normalising": `[{"slug": "Jane-Doe", "name": "A"}, {"name": "jane doe"}]`,
+		"malformed":                   `[{"name": `,
+	}
+	for name, data := range tests {
+		useTestSite(t, fstest.MapFS{authorsFile: {Data: []byte(data)}})
+		if _, err := loadAuthors(authorsFile); err == nil {
+			t.Errorf("%s: loadAuthors() succeeded, want an error", name)
+		}
+	}
+
+	useTestSite(t, fstest.MapFS{})
+	if authors, err := loadAuthors(authorsFile); authors != nil || err != nil {
+		t.Errorf("missing file: loadAuthors() = %v, %v; want nothing", authors, err)
+	}
+}
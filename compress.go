@@ -0,0 +1,375 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Content codings, in order of preference when the client accepts both
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// encodingExtensions maps each coding to the suffix of its precompressed
+// static sibling
+var encodingExtensions = map[string]string{
+	encodingBrotli: ".br",
+	encodingGzip:   ".gz",
+}
+
+// compressibleTypes are the media types worth compressing; images and fonts
+// are already compressed
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/feed+json",
+	"application/javascript",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+// isCompressible reports whether a response of contentType benefits from
+// compression
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks brotli or gzip from an Accept-Encoding header,
+// honouring q-values, or returns "" for an uncompressed response
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "*" {
+			coding = encodingBrotli
+		}
+		if (coding != encodingBrotli && coding != encodingGzip) || q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && coding == encodingBrotli) {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// etagForEncoding marks a strong entity tag as belonging to the compressed
+// representation, since its bytes differ from the uncompressed one
+func etagForEncoding(etag, encoding string) string {
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + encoding + `"`
+}
+
+// trimEncodingSuffix removes the marker added by etagForEncoding, so a
+// compressed copy revalidates against the uncompressed tag
+func trimEncodingSuffix(etag string) string {
+	for encoding := range encodingExtensions {
+		if strings.HasSuffix(etag, "-"+encoding+`"`) {
+			return etag[:len(etag)-len(encoding)-2] + `"`
+		}
+	}
+	return etag
+}
+
+// compressWriter compresses the body once the response turns out to be
+// compressible, deciding when the headers are about to be sent
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	encoder  io.WriteCloser
+	decided  bool
+}
+
+// start chooses whether to compress, from the headers the handler set. Once
+// the headers are out it is too late to announce a coding, so the body is
+// passed through.
+func (w *compressWriter) start(first []byte) {
+	w.decided = true
+	if w.Written() {
+		return
+	}
+	header := w.Header()
+	status := w.Status()
+	// A 304 validates the representation the client holds, which is the
+	// compressed one
+	if status == http.StatusNotModified {
+		if etag := header.Get("ETag"); etag != "" && header.Get("Content-Encoding") == "" {
+			header.Set("ETag", etagForEncoding(etag, w.encoding))
+		}
+		return
+	}
+	if header.Get("Content-Type") == "" && len(first) > 0 {
+		header.Set("Content-Type", http.DetectContentType(first))
+	}
+	if status < 200 || status == http.StatusNoContent ||
+		header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" ||
+		!isCompressible(header.Get("Content-Type")) {
+		return
+	}
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); etag != "" {
+		header.Set("ETag", etagForEncoding(etag, w.encoding))
+	}
+	if w.encoding == encodingBrotli {
+		w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+	} else {
+		w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.start(data)
+	}
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.encoder.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow decides on compression before sending the headers, which
+// would otherwise go out without Content-Encoding ahead of a compressed body
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.start(nil)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// compressResponses negotiates brotli or gzip compression for text
+// responses such as HTML, JSON, XML and feeds
+func compressResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = w
+		defer func() {
+			if w.encoder != nil {
+				w.encoder.Close()
+			}
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+		// A bodiless response such as a 304 still needs its headers fixed up
+		if !w.decided && !w.Written() {
+			w.start(nil)
+		}
+	}
+}
+
+// serveStatic serves the site files under root, preferring a .br or .gz
+// sibling of the file's current content when the client accepts that coding.
+// Other text files are compressed on the fly by compressResponses. Every
+// file carries an ETag from its content hash; fingerprinted names resolve to
+// their file and may be cached indefinitely.
+func serveStatic(root string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rel := strings.TrimPrefix(path.Clean("/"+c.Param("filepath")), "/")
+		cacheControl := revalidateCacheControl
+		if source, ok := assetSource(rel); ok {
+			rel = source
+			cacheControl = immutableCacheControl
+		}
+		name := path.Join(root, rel)
+		info, err := fs.Stat(siteFS, name)
+		if err != nil || info.IsDir() {
+			c.String(http.StatusNotFound, "404 page not found")
+			return
+		}
+		if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+			c.Header("Content-Type", contentType)
+		}
+		// Embedded files have no modification time, so the content hash in the
+		// manifest is the validator
+		var etag string
+		hashed, ok := assetFingerprint(rel)
+		if ok {
+			etag = fingerprintETag(hashed)
+			c.Header("Cache-Control", cacheControl)
+			c.Header("ETag", etag)
+			if notModified(c.Request, etag, info.ModTime()) {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+		// Siblings are named after the content they were compressed from, so
+		// one left over from an older version is never found
+		if encoding := negotiateEncoding(c.GetHeader("Accept-Encoding")); ok && encoding != "" {
+			if f, err := openSeekable(path.Join(root, hashed) + encodingExtensions[encoding]); err == nil {
+				defer f.Close()
+				c.Header("Content-Encoding", encoding)
+				c.Header("ETag", etagForEncoding(etag, encoding))
+				http.ServeContent(c.Writer, c.Request, name, info.ModTime(), f)
+				return
+			}
+		}
+		f, err := openSeekable(name)
+		if err != nil {
+			c.String(http.StatusNotFound, "404 page not found")
+			return
+		}
+		defer f.Close()
+		http.ServeContent(c.Writer, c.Request, name, info.ModTime(), f)
+	}
+}
+
+// openSeekable opens a site file for http.ServeContent, which seeks to
+// answer range requests. Embedded and on-disk files both support it.
+func openSeekable(name string) (io.ReadSeekCloser, error) {
+	f, err := siteFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	seeker, ok := f.(io.ReadSeekCloser)
+	if !ok {
+		f.Close()
+		return nil, fmt.Errorf("%s: file does not support seeking", name)
+	}
+	return seeker, nil
+}
+
+// precompressMinSize skips files too small to gain from compression
+const precompressMinSize = 1024
+
+// runPrecompressCommand implements the "precompress" subcommand:
+//
+//	precompress [-dir DIR]
+//
+// It writes .br and .gz siblings next to every compressible static file,
+// named after its fingerprint (style.1a2b3c4d5e6f.css.br), for serveStatic to
+// pick up, and removes siblings of older versions. Run it before building so
+// the siblings are embedded, and again after changing the files; until then
+// the changed files are compressed on the fly.
+func runPrecompressCommand(args []string) error {
+	flags := flag.NewFlagSet("precompress", flag.ContinueOnError)
+	dir := flags.String("dir", filepath.Join(siteDir, staticDir), "directory of static files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: precompress [-dir DIR]")
+	}
+	return filepath.WalkDir(*dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := filepath.Ext(name)
+		if ext == ".br" || ext == ".gz" || !isCompressible(mime.TypeByExtension(ext)) {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil || len(data) < precompressMinSize {
+			return err
+		}
+		hashed := filepath.Join(filepath.Dir(name), fingerprint(filepath.Base(name), data))
+		for encoding, suffix := range encodingExtensions {
+			if err := removeStaleSiblings(name, hashed+suffix); err != nil {
+				return err
+			}
+			size, err := writeCompressed(hashed+suffix, encoding, data)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d -> %d bytes\n", hashed+suffix, len(data), size)
+		}
+		return nil
+	})
+}
+
+// removeStaleSiblings deletes the compressed siblings of earlier versions of
+// source, keeping current
+func removeStaleSiblings(source, current string) error {
+	suffix := filepath.Ext(current)
+	ext := filepath.Ext(source)
+	stem := strings.TrimSuffix(source, ext) + "."
+	matches, err := filepath.Glob(stem + "*" + ext + suffix)
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		hash := strings.TrimSuffix(strings.TrimPrefix(match, stem), ext+suffix)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != hex.EncodedLen(fingerprintBytes) || match == current {
+			continue
+		}
+		if err := os.Remove(match); err != nil {
+			return err
+		}
+		fmt.Printf("%s: removed\n", match)
+	}
+	return nil
+}
+
+// writeCompressed writes data to path in the given coding at the highest
+// compression level, returning the compressed size
+func writeCompressed(path, encoding string, data []byte) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	var encoder io.WriteCloser
+	if encoding == encodingBrotli {
+		encoder = brotli.NewWriterLevel(f, brotli.BestCompression)
+	} else {
+		encoder, _ = gzip.NewWriterLevel(f, gzip.BestCompression)
+	}
+	if _, err := encoder.Write(data); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := encoder.Close(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	return info.Size(), f.Close()
+}
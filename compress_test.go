@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                            "",
+		"identity":                    "",
+		"gzip":                        "gzip",
+		"gzip, deflate, br":           "br",
+		"br;q=0.5, gzip":              "gzip",
+		"br;q=0, gzip;q=0":            "",
+		"GZIP;q=0.8, deflate":         "gzip",
+		"*":                           "br",
+		"*;q=0.1, gzip;q=0.5":         "gzip",
+		"br;q=bogus, gzip;q=0.2":      "gzip",
+		"gzip; q=0.9 , br ; q=0.9":    "br",
+		"compress, deflate, identity": "",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// decodeBody reverses the Content-Encoding of a recorded response
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var r io.Reader = w.Body
+	switch encoding := w.Result().Header.Get("Content-Encoding"); encoding {
+	case encodingBrotli:
+		r = brotli.NewReader(w.Body)
+	case encodingGzip:
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	case "":
+	default:
+		t.Fatalf("unexpected Content-Encoding %q", encoding)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	return string(data)
+}
+
+func TestCompressResponses(t *testing.T) {
+	useTestStore(t, nil)
+	page := strings.Repeat("<p>compressible page</p>\n", 100)
+	missing := strings.Repeat("<p>no such page</p>\n", 100)
+	png := strings.Repeat("\x89PNG", 100)
+
+	r := gin.New()
+	r.Use(compressResponses())
+	servePage := func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	}
+	r.GET("/page", cachePage(newestPostModified), servePage)
+	r.HEAD("/page", cachePage(newestPostModified), servePage)
+	r.GET("/missing", cachePage(newestPostModified), func(c *gin.Context) {
+		c.Data(http.StatusNotFound, "text/html; charset=utf-8", []byte(missing))
+	})
+	r.GET("/moved", cachePage(newestPostModified), func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/page")
+	})
+	r.GET("/image.png", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(png))
+	})
+
+	request := func(method, target, acceptEncoding string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, encoding := range []string{encodingBrotli, encodingGzip} {
+		t.Run(encoding, func(t *testing.T) {
+			tests := []struct {
+				target       string
+				wantStatus   int
+				wantEncoding string
+				wantBody     string
+			}{
+				{"/page", http.StatusOK, encoding, page},
+				// Served from the page cache the second time
+				{"/page", http.StatusOK, encoding, page},
+				{"/missing", http.StatusNotFound, encoding, missing},
+				{"/moved", http.StatusMovedPermanently, encoding, ""},
+				{"/image.png", http.StatusOK, "", png},
+			}
+			for _, tt := range tests {
+				w := request(http.MethodGet, tt.target, encoding)
+				header := w.Result().Header
+				if w.Code != tt.wantStatus || header.Get("Content-Encoding") != tt.wantEncoding {
+					t.Errorf("GET %s: status = %d, Content-Encoding = %q; want %d, %q", tt.target, w.Code, header.Get("Content-Encoding"), tt.wantStatus, tt.wantEncoding)
+					continue
+				}
+				if !strings.Contains(header.Get("Vary"), "Accept-Encoding") {
+					t.Errorf("GET %s: Vary = %q, want Accept-Encoding", tt.target, header.Get("Vary"))
+				}
+				if body := decodeBody(t, w); !strings.Contains(body, tt.wantBody) {
+					t.Errorf("GET %s: decoded body = %.60q, want %.60q", tt.target, body, tt.wantBody)
+				}
+			}
+
+			etag := request(http.MethodGet, "/page", encoding).Result().Header.Get("ETag")
+			if !strings.HasSuffix(etag, "-"+encoding+`"`) {
+				t.Fatalf("ETag = %s, want the %s suffix", etag, encoding)
+			}
+			w := request(http.MethodGet, "/page", encoding, "If-None-Match", etag)
+			if w.Code != http.StatusNotModified || w.Result().Header.Get("ETag") != etag || w.Body.Len() != 0 {
+				t.Errorf("revalidation: status = %d, ETag = %s, %d body bytes; want 304, %s, none", w.Code, w.Result().Header.Get("ETag"), w.Body.Len(), etag)
+			}
+		})
+	}
+
+	if w := request(http.MethodGet, "/page", ""); w.Result().Header.Get("Content-Encoding") != "" || w.Body.String() != page {
+		t.Errorf("without Accept-Encoding: Content-Encoding = %q", w.Result().Header.Get("Content-Encoding"))
+	}
+	if w := request(http.MethodHead, "/page", "gzip"); w.Code != http.StatusOK || w.Result().Header.Get("Content-Encoding") != "" {
+		t.Errorf("HEAD: status = %d, Content-Encoding = %q; want 200 uncompressed", w.Code, w.Result().Header.Get("Content-Encoding"))
+	}
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServeStaticPrecompressed(t *testing.T) {
+	oldCSS, newCSS := "body { color: red }", "body { color: blue }"
+	script := "console.log('hello')"
+	scriptName := fingerprint("app.js", []byte(script))
+	useTestSite(t, fstest.MapFS{
+		"public/style.css": {Data: []byte(newCSS)},
+		// Left over from before the last edit; its name gives it away
+		"public/" + fingerprint("style.css", []byte(oldCSS)) + ".gz": {Data: gzipped(t, oldCSS)},
+		"public/app.js":                {Data: []byte(script)},
+		"public/" + scriptName + ".gz": {Data: gzipped(t, script)},
+	})
+	previous := assets.Load()
+	t.Cleanup(func() { assets.Store(previous) })
+	if err := loadAssets(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/public/*filepath", serveStatic(staticDir))
+	tests := []struct {
+		target       string
+		wantEncoding string
+		wantBody     string
+	}{
+		{"/public/style.css", "", newCSS},
+		{"/public/app.js", encodingGzip, script},
+		{"/public/" + scriptName, encodingGzip, script},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if encoding := w.Result().Header.Get("Content-Encoding"); w.Code != http.StatusOK || encoding != tt.wantEncoding {
+			t.Errorf("GET %s: status = %d, Content-Encoding = %q; want 200, %q", tt.target, w.Code, encoding, tt.wantEncoding)
+			continue
+		}
+		if body := decodeBody(t, w); body != tt.wantBody {
+			t.Errorf("GET %s: body = %q, want %q", tt.target, body, tt.wantBody)
+		}
+	}
+}
+
+func TestPrecompressReplacesStaleSiblings(t *testing.T) {
+	dir := t.TempDir()
+	css := []byte(strings.Repeat("body { color: blue }\n", 100))
+	files := map[string][]byte{
+		"style.css":                 css,
+		"style.0123456789ab.css.br": []byte("stale"),
+		"style.0123456789ab.css.gz": []byte("stale"),
+		"style.min.css.gz":          []byte("not a sibling of style.css"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	err := runPrecompressCommand([]string{"-dir", dir})
+	os.Stdout.Close()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	hashed := fingerprint("style.css", css)
+	want := []string{"style.css", hashed + ".br", hashed + ".gz", "style.min.css.gz"}
+	sort.Strings(want)
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("after precompress, files = %v, want %v", names, want)
+	}
+}
+
+func TestServeStaticValidators(t *testing.T) {
+	css, script := "body { color: blue }", "console.log('hello')"
+	cssName, scriptName := fingerprint("style.css", []byte(css)), fingerprint("app.js", []byte(script))
+	useTestSite(t, fstest.MapFS{
+		"public/style.css":             {Data: []byte(css)},
+		"public/app.js":                {Data: []byte(script)},
+		"public/" + scriptName + ".gz": {Data: gzipped(t, script)},
+	})
+	previous := assets.Load()
+	t.Cleanup(func() { assets.Store(previous) })
+	if err := loadAssets(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(compressResponses())
+	r.GET("/public/*filepath", serveStatic(staticDir))
+	request := func(target, acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		target         string
+		acceptEncoding string
+		wantETag       string
+		wantCache      string
+	}{
+		{"/public/style.css", "", fingerprintETag(cssName), revalidateCacheControl},
+		// Compressed on the fly
+		{"/public/style.css", "gzip", etagForEncoding(fingerprintETag(cssName), encodingGzip), revalidateCacheControl},
+		{"/public/" + cssName, "br", etagForEncoding(fingerprintETag(cssName), encodingBrotli), immutableCacheControl},
+		// Served from the precompressed sibling
+		{"/public/app.js", "gzip", etagForEncoding(fingerprintETag(scriptName), encodingGzip), revalidateCacheControl},
+	}
+	for _, tt := range tests {
+		w := request(tt.target, tt.acceptEncoding, "")
+		header := w.Result().Header
+		if w.Code != http.StatusOK || header.Get("ETag") != tt.wantETag || header.Get("Cache-Control") != tt.wantCache {
+			t.Errorf("GET %s (%s): status = %d, ETag = %s, Cache-Control = %q; want 200, %s, %q",
+				tt.target, tt.acceptEncoding, w.Code, header.Get("ETag"), header.Get("Cache-Control"), tt.wantETag, tt.wantCache)
+			continue
+		}
+		w = request(tt.target, tt.acceptEncoding, tt.wantETag)
+		if w.Code != http.StatusNotModified || w.Result().Header.Get("ETag") != tt.wantETag || w.Body.Len() != 0 {
+			t.Errorf("revalidating %s (%s): status = %d, ETag = %s, %d body bytes; want 304, %s, none",
+				tt.target, tt.acceptEncoding, w.Code, w.Result().Header.Get("ETag"), w.Body.Len(), tt.wantETag)
+		}
+	}
+
+	// A tag from before the file changed fetches the new content
+	if w := request("/public/style.css", "", fingerprintETag(fingerprint("style.css", []byte("body {}")))); w.Code != http.StatusOK || w.Body.String() != css {
+		t.Errorf("stale ETag: status = %d, body = %q; want 200 with the current file", w.Code, w.Body.String())
+	}
+}
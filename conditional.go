@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// strongETag derives a strong entity tag from the response body
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// serveConditional writes body with ETag and Last-Modified validators and
+// answers 304 Not Modified when the client's copy is still current. A zero
+// lastModified omits the Last-Modified header.
+func serveConditional(c *gin.Context, status int, contentType string, body []byte, lastModified time.Time) {
+	etag := strongETag(body)
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if status == http.StatusOK && notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, contentType, body)
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since
+// only when no entity tags were sent (RFC 9110 section 13.2.2)
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = trimEncodingSuffix(strings.TrimPrefix(strings.TrimSpace(candidate), "W/"))
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !lastModified.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
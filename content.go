@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// contentDir holds Markdown posts with YAML (---) or TOML (+++) front matter
+const contentDir = "content"
+
+// dateFormats lists the date layouts accepted in front matter and posts.json
+var dateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ContentError describes a problem with a single field of a content file
+type ContentError struct {
+	File    string
+	Field   string
+	Message string
+}
+
+func (e *ContentError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s: field %q: %s", e.File, e.Field, e.Message)
+}
+
+// splitFrontMatter separates a leading front matter block from the document
+// body. It returns the format ("yaml", "toml" or "" when there is none), the
+// raw front matter and the remaining Markdown.
+func splitFrontMatter(data []byte) (format string, meta, body []byte, err error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	var fence string
+	switch {
+	case bytes.HasPrefix(data, []byte("---")):
+		format, fence = "yaml", "---"
+	case bytes.HasPrefix(data, []byte("+++")):
+		format, fence = "toml", "+++"
+	default:
+		return "", nil, data, nil
+	}
+
+	firstLine, rest, _ := bytes.Cut(data, []byte("\n"))
+	if strings.TrimSpace(string(firstLine)) != fence {
+		return "", nil, data, nil
+	}
+	for offset := 0; offset < len(rest); {
+		line, _, _ := bytes.Cut(rest[offset:], []byte("\n"))
+		if strings.TrimSpace(string(line)) == fence {
+			body = rest[min(offset+len(line)+1, len(rest)):]
+			return format, rest[:offset], body, nil
+		}
+		offset += len(line) + 1
+	}
+	return "", nil, nil, fmt.Errorf("unterminated %s front matter", format)
+}
+
+// stripFrontMatter returns the Markdown body of a document, dropping any
+// front matter block
+func stripFrontMatter(data []byte) []byte {
+	_, _, body, err := splitFrontMatter(data)
+	if err != nil {
+		return data
+	}
+	return body
+}
+
+// parseDate parses a date in any of the accepted dateFormats
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q (expected YYYY-MM-DD or RFC 3339)", value)
+}
+
+// slugSymbols spells out symbols that tell names apart, so C++, C# and C
+// get different slugs
+var slugSymbols = strings.NewReplacer("+", " plus ", "#", " sharp ")
+
+// slugify derives a URL slug from a display name
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(slugSymbols.Replace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// parseContentFile reads a Markdown file and builds a Post from its front
+// matter
+func parseContentFile(path string) (*Post, error) {
+	data, err := fs.ReadFile(siteFS, path)
+	if err != nil {
+		return nil, &ContentError{File: path, Message: err.Error()}
+	}
+	format, meta, _, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, &ContentError{File: path, Message: err.Error()}
+	}
+	if format == "" {
+		return nil, &ContentError{File: path, Message: "missing front matter"}
+	}
+
+	fields := map[string]interface{}{}
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(meta, &fields)
+	case "toml":
+		err = toml.Unmarshal(meta, &fields)
+	}
+	if err != nil {
+		return nil, &ContentError{File: path, Message: fmt.Sprintf("invalid %s front matter: %v", format, err)}
+	}
+
+	fm := frontMatterFields{file: path, fields: fields}
+	post := &Post{
+		Slug:         fm.string("slug"),
+		Title:        fm.string("title"),
+		Description:  fm.string("description"),
+		Author:       fm.string("author"),
+		Date:         fm.date("date"),
+		Updated:      fm.date("updated"),
+		Status:       fm.string("status"),
+		PublishAt:    fm.date("publish_at"),
+		Series:       fm.string("series"),
+		SeriesPart:   fm.int("series_part"),
+		TOC:          fm.string("toc"),
+		Tags:         fm.strings("tags"),
+		Category:     fm.string("category"),
+		MarkdownPath: filepath.ToSlash(path),
+		ContentFile:  path,
+	}
+	// "draft: true" predates the status field
+	if fm.bool("draft") && post.Status == "" {
+		post.Status = StatusDraft
+	}
+	if post.Status == "" {
+		post.Status = StatusPublished
+	}
+
+	if post.Slug == "" {
+		post.Slug = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if post.Title == "" && fm.err == nil {
+		fm.fail("title", "is required")
+	}
+	if post.Date.IsZero() && fm.err == nil {
+		fm.fail("date", "is required")
+	}
+	if post.Updated.Before(post.Date) && !post.Updated.IsZero() && fm.err == nil {
+		fm.fail("updated", "is before the publication date")
+	}
+	if post.SeriesPart < 0 && fm.err == nil {
+		fm.fail("series_part", "must be positive")
+	}
+	if !validTOC(post.TOC) && fm.err == nil {
+		fm.fail("toc", fmt.Sprintf("must be %s, %s or %s", TOCInline, TOCSidebar, TOCNone))
+	}
+	if !validStatus(post.Status) && fm.err == nil {
+		fm.fail("status", fmt.Sprintf("must be %s, %s, %s or %s", StatusPublished, StatusScheduled, StatusUnlisted, StatusDraft))
+	}
+	if fm.err != nil {
+		return nil, fm.err
+	}
+	return post, nil
+}
+
+// frontMatterFields extracts typed values from decoded front matter,
+// remembering the first validation error it runs into
+type frontMatterFields struct {
+	file   string
+	fields map[string]interface{}
+	err    error
+}
+
+func (f *frontMatterFields) fail(field, message string) {
+	if f.err == nil {
+		f.err = &ContentError{File: f.file, Field: field, Message: message}
+	}
+}
+
+func (f *frontMatterFields) string(field string) string {
+	v, ok := f.fields[field]
+	if !ok || v == nil {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		f.fail(field, fmt.Sprintf("expected a string, got %T", v))
+		return ""
+	}
+	return strings.TrimSpace(s)
+}
+
+// int reads a whole number. YAML decodes integers as int and TOML as int64.
+func (f *frontMatterFields) int(field string) int {
+	v, ok := f.fields[field]
+	if !ok || v == nil {
+		return 0
+	}
+	switch v := v.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	f.fail(field, fmt.Sprintf("expected a whole number, got %T", v))
+	return 0
+}
+
+func (f *frontMatterFields) bool(field string) bool {
+	v, ok := f.fields[field]
+	if !ok || v == nil {
+		return false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		f.fail(field, fmt.Sprintf("expected true or false, got %T", v))
+	}
+	return b
+}
+
+func (f *frontMatterFields) strings(field string) []string {
+	v, ok := f.fields[field]
+	if !ok || v == nil {
+		return nil
+	}
+	switch v := v.(type) {
+	case string:
+		// Allow a comma separated list as a shorthand
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				f.fail(field, fmt.Sprintf("expected a list of strings, found %T", item))
+				return nil
+			}
+			out = append(out, strings.TrimSpace(s))
+		}
+		return out
+	}
+	f.fail(field, fmt.Sprintf("expected a list of strings, got %T", v))
+	return nil
+}
+
+// date reads a front matter date. YAML and TOML may hand back either a
+// string or a native date value depending on quoting.
+func (f *frontMatterFields) date(field string) time.Time {
+	v, ok := f.fields[field]
+	if !ok || v == nil {
+		return time.Time{}
+	}
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := parseDate(v)
+		if err != nil {
+			f.fail(field, err.Error())
+			return time.Time{}
+		}
+		t = parsed
+	case fmt.Stringer:
+		// toml.LocalDate and toml.LocalDateTime
+		parsed, err := parseDate(v.String())
+		if err != nil {
+			f.fail(field, err.Error())
+			return time.Time{}
+		}
+		t = parsed
+	default:
+		f.fail(field, fmt.Sprintf("expected a date, got %T", v))
+		return time.Time{}
+	}
+	return t
+}
+
+// loadContentDir builds posts from every Markdown file under dir. Files that
+// fail validation are reported individually and skipped, so one bad article
+// does not take the whole site down.
+func loadContentDir(dir string) ([]Post, []error, error) {
+	var (
+		loaded []Post
+		errs   []error
+		seen   = map[string]string{}
+	)
+	err := fs.WalkDir(siteFS, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		post, err := parseContentFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if other, ok := seen[post.Slug]; ok {
+			errs = append(errs, &ContentError{File: path, Field: "slug", Message: fmt.Sprintf("%q is already used by %s", post.Slug, other)})
+			return nil
+		}
+		seen[post.Slug] = path
+		loaded = append(loaded, *post)
+		return nil
+	})
+	return loaded, errs, err
+}
+
+// loadLegacyPosts reads posts from the hand-maintained posts.json file
+func loadLegacyPosts(path string) ([]Post, error) {
+	file, err := fs.ReadFile(siteFS, path)
+	if err != nil {
+		return nil, err
+	}
+	var legacy []Post
+	if err := json.Unmarshal(file, &legacy); err != nil {
+		return nil, err
+	}
+	return legacy, nil
+}
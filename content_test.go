@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseContentFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		want      Post
+		wantField string
+	}{
+		{
+			name: "yaml",
+			source: `---
+title: Rendering Pipelines
+date: 2025-04-01
+updated: "2025-04-03"
+tags: [graphics, opengl]
+category: Tutorials
+author: Ada
+description: A tour.
+---
+Body.
+`,
+			want: Post{
+				Slug:         "rendering-pipelines",
+				Title:        "Rendering Pipelines",
+				Description:  "A tour.",
+				Author:       "Ada",
+				Date:         time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+				Updated:      time.Date(2025, 4, 3, 0, 0, 0, 0, time.UTC),
+				Status:       StatusPublished,
+				Tags:         []string{"graphics", "opengl"},
+				Category:     "Tutorials",
+				MarkdownPath: "content/rendering-pipelines.md",
+				ContentFile:  "content/rendering-pipelines.md",
+			},
+		},
+		{
+			name: "toml with explicit slug and draft flag",
+			source: `+++
+title = "Shaders"
+slug = "intro-to-shaders"
+date = 2025-05-06
+tags = "glsl, shaders"
+draft = true
++++
+Body.
+`,
+			want: Post{
+				Slug:         "intro-to-shaders",
+				Title:        "Shaders",
+				Date:         time.Date(2025, 5, 6, 0, 0, 0, 0, time.UTC),
+				Status:       StatusDraft,
+				Tags:         []string{"glsl", "shaders"},
+				MarkdownPath: "content/rendering-pipelines.md",
+				ContentFile:  "content/rendering-pipelines.md",
+			},
+		},
+		{
+			name:      "missing title",
+			source:    "---\ndate: 2025-01-01\n---\n",
+			wantField: "title",
+		},
+		{
+			name:      "bad date",
+			source:    "---\ntitle: T\ndate: yesterday\n---\n",
+			wantField: "date",
+		},
+		{
+			name:      "tags of the wrong type",
+			source:    "---\ntitle: T\ndate: 2025-01-01\ntags: 3\n---\n",
+			wantField: "tags",
+		},
+		{
+			name:      "unknown status",
+			source:    "---\ntitle: T\ndate: 2025-01-01\nstatus: hidden\n---\n",
+			wantField: "status",
+		},
+		{
+			name:   "no front matter",
+			source: "# Just Markdown\n",
+		},
+		{
+			name:   "unterminated front matter",
+			source: "---\ntitle: T\n",
+		},
+	}
+	const path = "content/rendering-pipelines.md"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestSite(t, fstest.MapFS{path: {Data: []byte(tt.source)}})
+			post, err := parseContentFile(path)
+			if tt.want.Slug == "" {
+				var cerr *ContentError
+				if !errors.As(err, &cerr) {
+					t.Fatalf("parseContentFile() error = %v, want a ContentError", err)
+				}
+				if cerr.File != path || cerr.Field != tt.wantField {
+					t.Errorf("error names file %q field %q, want %q field %q", cerr.File, cerr.Field, path, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseContentFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(*post, tt.want) {
+				t.Errorf("parseContentFile() =\n%+v\nwant\n%+v", *post, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadContentDirDuplicateSlug(t *testing.T) {
+	useTestSite(t, fstest.MapFS{
+		"content/a.md":        {Data: []byte("---\ntitle: A\nslug: same\ndate: 2025-01-01\n---\n")},
+		"content/nested/b.md": {Data: []byte("---\ntitle: B\nslug: same\ndate: 2025-01-02\n---\n")},
+		"content/notes.txt":   {Data: []byte("ignored")},
+	})
+	posts, errs, err := loadContentDir(contentDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].Title != "A" {
+		t.Errorf("loadContentDir() posts = %+v, want only A", posts)
+	}
+	var cerr *ContentError
+	if len(errs) != 1 || !errors.As(errs[0], &cerr) || cerr.Field != "slug" {
+		t.Errorf("loadContentDir() errors = %v, want one slug error", errs)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Game Dev":            "game-dev",
+		"  Shaders & GLSL!  ": "shaders-glsl",
+		"C":                   "c",
+		"C++":                 "c-plus-plus",
+		"C#":                  "c-sharp",
+		"F# vs C++":           "f-sharp-vs-c-plus-plus",
+		"Über-Straße":         "über-straße",
+		"!!!":                 "",
+	}
+	for name, want := range tests {
+		if got := slugify(name); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
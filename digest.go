@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Digest email templates. They are parsed on demand because digests are
+// only composed occasionally.
+const (
+	digestHTMLTemplate = "templates/email/digest.html"
+	digestTextTemplate = "templates/email/digest.txt"
+)
+
+// digestDir stores per-recipient delivery status for each digest
+func digestDir() string {
+	return filepath.Join(dataDir(), "digests")
+}
+
+// Digest is the set of posts published within a date window
+type Digest struct {
+	Since time.Time
+	Until time.Time
+	Posts []Post
+}
+
+// ID identifies the digest for delivery tracking, so re-running a send for
+// the same window resumes instead of emailing everybody twice
+func (d Digest) ID() string {
+	return d.Since.UTC().Format("20060102T150405") + "-" + d.Until.UTC().Format("20060102T150405")
+}
+
+// newDigest collects the listed posts dated within [since, until)
+func newDigest(all []Post, since, until time.Time) Digest {
+	d := Digest{Since: since, Until: until}
+	now := time.Now()
+	for _, post := range all {
+		if post.Listed(now) && !post.Date.Before(since) && post.Date.Before(until) {
+			d.Posts = append(d.Posts, post)
+		}
+	}
+	return d
+}
+
+// ForSubscriber narrows the digest to the posts matching the subscriber's
+// tag preferences
+func (d Digest) ForSubscriber(sub Subscriber) Digest {
+	out := Digest{Since: d.Since, Until: d.Until}
+	for _, post := range d.Posts {
+		if sub.WantsPost(post) {
+			out.Posts = append(out.Posts, post)
+		}
+	}
+	return out
+}
+
+// digestCards prepares the email template data for each post. Unlike the
+// site's post cards the fields are left unescaped: the HTML template escapes
+// them itself and the text template must not.
+func digestCards(snap *ContentSnapshot, posts []Post) []map[string]interface{} {
+	cards := make([]map[string]interface{}, len(posts))
+	for i, post := range posts {
+		cards[i] = map[string]interface{}{
+			"Title":         post.Title,
+			"Description":   post.Description,
+			"Author":        post.Author,
+			"FormattedDate": post.Date.Format("Jan 2, 2006"),
+			"Icon":          getPostImageData(snap, post)["Icon"],
+			"URL":           postURL(post.Slug),
+		}
+	}
+	return cards
+}
+
+// Compose renders the digest into an email for email
+func (d Digest) Compose(email string) (Message, error) {
+	data := map[string]interface{}{
+		"Posts":     digestCards(contentStore.Snapshot(), d.Posts),
+		"Since":     d.Since.Format("Jan 2, 2006"),
+		"Until":     d.Until.Format("Jan 2, 2006"),
+		"SiteURL":   siteURL,
+		"ManageURL": manageURL(email),
+	}
+
+	htmlTmpl, err := htmltemplate.ParseFS(siteFS, digestHTMLTemplate)
+	if err != nil {
+		return Message{}, err
+	}
+	var htmlBody bytes.Buffer
+	if err := htmlTmpl.Execute(&htmlBody, data); err != nil {
+		return Message{}, err
+	}
+
+	textTmpl, err := texttemplate.ParseFS(siteFS, digestTextTemplate)
+	if err != nil {
+		return Message{}, err
+	}
+	var textBody bytes.Buffer
+	if err := textTmpl.Execute(&textBody, data); err != nil {
+		return Message{}, err
+	}
+
+	subject := "New on CodeNPixel"
+	if len(d.Posts) == 1 {
+		subject += ": " + d.Posts[0].Title
+	} else {
+		subject += fmt.Sprintf(": %d new posts", len(d.Posts))
+	}
+	return Message{
+		To:      email,
+		Subject: subject,
+		Text:    textBody.String(),
+		HTML:    htmlBody.String(),
+		Headers: unsubscribeHeaders(email),
+	}, nil
+}
+
+// Delivery statuses
+const (
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliverySkipped = "skipped"
+)
+
+// Delivery records what happened when sending a digest to one recipient
+type Delivery struct {
+	Email    string    `json:"email"`
+	Status   string    `json:"status"`
+	Posts    int       `json:"posts"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// DigestSender delivers a digest to every confirmed subscriber, retrying
+// transient failures and recording the outcome for each recipient
+type DigestSender struct {
+	Mailer   Mailer
+	Attempts int
+	Backoff  time.Duration
+	// StatusDir holds one JSON-lines status file per digest
+	StatusDir string
+}
+
+// Send delivers d and returns the status of every recipient. Recipients
+// already marked as sent for this digest are not emailed again.
+func (s *DigestSender) Send(d Digest, subs []Subscriber) ([]Delivery, error) {
+	if err := os.MkdirAll(s.StatusDir, 0o755); err != nil {
+		return nil, err
+	}
+	statusPath := filepath.Join(s.StatusDir, d.ID()+".jsonl")
+	done, err := sentRecipients(statusPath)
+	if err != nil {
+		return nil, err
+	}
+	statusFile, err := os.OpenFile(statusPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer statusFile.Close()
+	enc := json.NewEncoder(statusFile)
+
+	var results []Delivery
+	for _, sub := range subs {
+		if sub.Status != SubscriberConfirmed || done[subscriberKey(sub.Email)] {
+			continue
+		}
+		result := s.deliver(d.ForSubscriber(sub), sub.Email)
+		if err := enc.Encode(result); err != nil {
+			return results, fmt.Errorf("recording delivery status: %w", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// deliver sends one recipient's digest with retries
+func (s *DigestSender) deliver(d Digest, email string) Delivery {
+	result := Delivery{Email: email, Posts: len(d.Posts)}
+	if len(d.Posts) == 0 {
+		result.Status, result.At = DeliverySkipped, time.Now().UTC()
+		return result
+	}
+	msg, err := d.Compose(email)
+	if err != nil {
+		result.Status, result.Error, result.At = DeliveryFailed, err.Error(), time.Now().UTC()
+		return result
+	}
+
+	backoff := s.Backoff
+	for result.Attempts < max(s.Attempts, 1) {
+		result.Attempts++
+		if err = s.Mailer.Send(msg); err == nil {
+			result.Status, result.Error, result.At = DeliverySent, "", time.Now().UTC()
+			return result
+		}
+		log.Printf("Digest to %s failed (attempt %d): %v", email, result.Attempts, err)
+		if result.Attempts < s.Attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	result.Status, result.Error, result.At = DeliveryFailed, err.Error(), time.Now().UTC()
+	return result
+}
+
+// sentRecipients reads a digest status file and returns the addresses that
+// were already delivered
+func sentRecipients(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			continue
+		}
+		done[subscriberKey(d.Email)] = d.Status == DeliverySent
+	}
+	return done, scanner.Err()
+}
+
+// runDigestCommand implements the "digest" subcommand:
+//
+//	digest preview [-since DATE] [-until DATE] [-email ADDR] [-format html|text]
+//	digest send    [-since DATE] [-until DATE] [-attempts N]
+func runDigestCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "preview" && args[0] != "send") {
+		return errors.New("usage: digest preview|send [flags]")
+	}
+	mode := args[0]
+	flags := flag.NewFlagSet("digest "+mode, flag.ContinueOnError)
+	since := flags.String("since", time.Now().AddDate(0, 0, -7).Format("2006-01-02"), "include posts dated on or after this date")
+	until := flags.String("until", time.Now().AddDate(0, 0, 1).Format("2006-01-02"), "include posts dated before this date")
+	email := flags.String("email", "reader@example.com", "preview the digest as this subscriber")
+	format := flags.String("format", "text", "preview format: text or html")
+	attempts := flags.Int("attempts", 3, "delivery attempts per recipient")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	sinceDate, err := parseDate(*since)
+	if err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	untilDate, err := parseDate(*until)
+	if err != nil {
+		return fmt.Errorf("-until: %w", err)
+	}
+	loaded, skipped, err := readPosts(nil)
+	if err != nil {
+		return err
+	}
+	logSkipped(skipped)
+	// Post cards resolve authors and tags through the content store
+	authors, err := loadAuthors(authorsFile)
+	if err != nil {
+		return err
+	}
+	taxonomy, err := loadTaxonomy(taxonomyFile)
+	if err != nil {
+		return err
+	}
+	contentStore = NewContentStore(loaded, authors, taxonomy, nil)
+	digest := newDigest(loaded, sinceDate, untilDate)
+
+	backend, err := newSubscriberBackendFromEnv()
+	if err != nil {
+		return err
+	}
+	subscriberStore, err = NewSubscriberStore(backend)
+	if err != nil {
+		return err
+	}
+
+	if mode == "preview" {
+		if sub, ok := subscriberStore.Get(*email); ok {
+			digest = digest.ForSubscriber(sub)
+		}
+		if len(digest.Posts) == 0 {
+			return fmt.Errorf("no posts between %s and %s", *since, *until)
+		}
+		msg, err := digest.Compose(*email)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("To: %s\nSubject: %s\n\n", msg.To, msg.Subject)
+		if strings.EqualFold(*format, "html") {
+			fmt.Print(msg.HTML)
+		} else {
+			fmt.Print(msg.Text)
+		}
+		return nil
+	}
+
+	if len(digest.Posts) == 0 {
+		log.Printf("No posts between %s and %s, nothing to send", *since, *until)
+		return nil
+	}
+	sender := &DigestSender{Mailer: newMailerFromEnv(), Attempts: *attempts, Backoff: 2 * time.Second, StatusDir: digestDir()}
+	results, err := sender.Send(digest, subscriberStore.List())
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	log.Printf("Digest %s: %d sent, %d skipped, %d failed", digest.ID(), counts[DeliverySent], counts[DeliverySkipped], counts[DeliveryFailed])
+	return err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func digestTestPosts() []Post {
+	date := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	return []Post{
+		{Slug: "nanite", Title: "Unreal Engine's Nanite & You", Description: "Why <virtualized> geometry matters.", Author: "Pat O'Brien", Tags: []string{"unreal"}, Date: date, Status: StatusPublished},
+		{Slug: "vaos", Title: "Vertex Array Objects", Description: "Binding state once.", Author: "Sam Roe", Tags: []string{"opengl"}, Date: date.AddDate(0, 0, 1), Status: StatusPublished},
+	}
+}
+
+func TestDigestCompose(t *testing.T) {
+	useTestStore(t, digestTestPosts())
+	d := Digest{Since: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC), Posts: digestTestPosts()[:1]}
+	msg, err := d.Compose("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "New on CodeNPixel: Unreal Engine's Nanite & You" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	for _, want := range []string{"Unreal Engine&#39;s Nanite &amp; You", "Why &lt;virtualized&gt; geometry", "Pat O&#39;Brien", postURL("nanite")} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("HTML body lacks %q", want)
+		}
+	}
+	if strings.Contains(msg.HTML, "&amp;#39;") || strings.Contains(msg.HTML, "&amp;amp;") {
+		t.Error("HTML body is escaped twice")
+	}
+	for _, want := range []string{"Unreal Engine's Nanite & You", "Why <virtualized> geometry", "Pat O'Brien", postURL("nanite")} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("text body lacks %q", want)
+		}
+	}
+	if msg.Headers["List-Unsubscribe"] == "" || !strings.Contains(msg.Text, manageURL("reader@example.com")) {
+		t.Error("digest lacks its unsubscribe link")
+	}
+}
+
+// flakyMailer fails a recipient's first sends, as many times as failures
+// says
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures map[string]int
+	sent     []string
+}
+
+// Send implements Mailer
+func (m *flakyMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures[msg.To] > 0 {
+		m.failures[msg.To]--
+		return errors.New("relay busy")
+	}
+	m.sent = append(m.sent, msg.To)
+	return nil
+}
+
+func TestDigestSenderRetriesAndResumes(t *testing.T) {
+	useTestStore(t, digestTestPosts())
+	d := Digest{Since: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC), Posts: digestTestPosts()}
+	subs := []Subscriber{
+		{Email: "flaky@example.com", Status: SubscriberConfirmed},
+		{Email: "down@example.com", Status: SubscriberConfirmed},
+		{Email: "pending@example.com", Status: SubscriberPending},
+		{Email: "vulkan@example.com", Status: SubscriberConfirmed, Tags: []string{"vulkan"}},
+	}
+	mailer := &flakyMailer{failures: map[string]int{"flaky@example.com": 1, "down@example.com": 5}}
+	sender := &DigestSender{Mailer: mailer, Attempts: 2, StatusDir: t.TempDir()}
+
+	results, err := sender.Send(d, subs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Delivery{
+		{Email: "flaky@example.com", Status: DeliverySent, Posts: 2, Attempts: 2},
+		{Email: "down@example.com", Status: DeliveryFailed, Posts: 2, Attempts: 2},
+		{Email: "vulkan@example.com", Status: DeliverySkipped},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Send() = %+v, want %d deliveries", results, len(want))
+	}
+	for i, got := range results {
+		w := want[i]
+		if got.Email != w.Email || got.Status != w.Status || got.Posts != w.Posts || got.Attempts != w.Attempts {
+			t.Errorf("delivery %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	// Running the same digest again only retries the recipients it missed
+	mailer.failures = nil
+	results, err = sender.Send(d, subs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var emailed []string
+	for _, r := range results {
+		if r.Status == DeliverySent {
+			emailed = append(emailed, r.Email)
+		}
+	}
+	if strings.Join(emailed, " ") != "down@example.com" {
+		t.Errorf("resumed send emailed %v, want only down@example.com", emailed)
+	}
+	if strings.Join(mailer.sent, " ") != "flaky@example.com down@example.com" {
+		t.Errorf("mailer sent to %v over both runs, want each confirmed reader once", mailer.sent)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RSS 2.0 document, with the content and Dublin Core extensions for full
+// post bodies and authors
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	DCNS      string     `xml:"xmlns:dc,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	Self          rssSelfLink `xml:"atom:link"`
+	Language      string      `xml:"language"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssSelfLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+	Content     cdata    `xml:"content:encoded"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+// Atom 1.0 document
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    atomText       `xml:"summary"`
+	Content    atomText       `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// JSON Feed 1.1 document (https://jsonfeed.org/version/1.1)
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// feedSource is the filtered, date-ordered post list a feed is built from
+type feedSource struct {
+	Title       string
+	Description string
+	// PageURL is the HTML listing the feed mirrors
+	PageURL string
+	Posts   []Post
+	Updated time.Time
+}
+
+// postURL returns the canonical address of a post
+func postURL(slug string) string {
+	return fmt.Sprintf("%s/post/%s", siteURL, url.PathEscape(slug))
+}
+
+// newFeedSource resolves the same filter=tag|category|author query as /posts. It
+// returns false when a filter matches nothing.
+func newFeedSource(snap *ContentSnapshot, filterType, filterValue string) (feedSource, bool) {
+	src := feedSource{
+		Title:       "CodeNPixel",
+		Description: "Game development and graphics programming articles from CodeNPixel.",
+		PageURL:     siteURL + "/posts",
+		Posts:       sortPosts(filterPosts(snap, filterType, filterValue), sortNewest),
+	}
+	switch {
+	case filterType == kindTag && filterValue != "":
+		if term, ok := snap.Tag(filterValue); ok {
+			src.Title = fmt.Sprintf(`CodeNPixel - Posts tagged "%s"`, term.Name)
+			src.Description = fmt.Sprintf(`Posts tagged with "%s" on game development and graphics programming at CodeNPixel.`, term.Name)
+			src.PageURL = term.URL()
+		}
+	case filterType == kindCategory && filterValue != "":
+		if term, ok := snap.Category(filterValue); ok {
+			src.Title = fmt.Sprintf("CodeNPixel - %s Posts", term.Name)
+			src.Description = fmt.Sprintf("%s posts on game development and graphics programming at CodeNPixel.", term.Name)
+			src.PageURL = term.URL()
+		}
+	case filterType == "author" && filterValue != "":
+		if author, ok := snap.Author(filterValue); ok {
+			src.Title = fmt.Sprintf("CodeNPixel - Posts by %s", author.Name)
+			src.Description = fmt.Sprintf("Posts by %s on game development and graphics programming at CodeNPixel.", author.Name)
+			src.PageURL = author.URL()
+		}
+	}
+	if len(src.Posts) == 0 && filterValue != "" {
+		return src, false
+	}
+	for _, post := range src.Posts {
+		if post.LastModified().After(src.Updated) {
+			src.Updated = post.LastModified()
+		}
+	}
+	return src, true
+}
+
+// buildRSS renders src as an RSS 2.0 document
+func buildRSS(src feedSource, selfURL string) ([]byte, error) {
+	feed := rssFeed{
+		Version:   "2.0",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		DCNS:      "http://purl.org/dc/elements/1.1/",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       src.Title,
+			Link:        src.PageURL,
+			Description: src.Description,
+			Self:        rssSelfLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+			Language:    "en",
+		},
+	}
+	if !src.Updated.IsZero() {
+		feed.Channel.LastBuildDate = src.Updated.Format(time.RFC1123Z)
+	}
+	for _, post := range src.Posts {
+		item := rssItem{
+			Title:       post.Title,
+			Link:        postURL(post.Slug),
+			GUID:        rssGUID{IsPermaLink: true, Value: postURL(post.Slug)},
+			Creator:     post.Author,
+			Description: post.Description,
+			Content:     cdata{Value: postContent(post)},
+		}
+		if !post.Date.IsZero() {
+			item.PubDate = post.Date.Format(time.RFC1123Z)
+		}
+		for _, tag := range post.Tags {
+			item.Categories = append(item.Categories, normalizeTag(tag))
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return marshalFeed(feed)
+}
+
+// buildAtom renders src as an Atom 1.0 document
+func buildAtom(src feedSource, selfURL string) ([]byte, error) {
+	feed := atomFeed{
+		Title:    src.Title,
+		Subtitle: src.Description,
+		ID:       src.PageURL,
+		Updated:  src.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: src.PageURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, post := range src.Posts {
+		entry := atomEntry{
+			Title:   post.Title,
+			ID:      postURL(post.Slug),
+			Link:    atomLink{Href: postURL(post.Slug), Rel: "alternate", Type: "text/html"},
+			Summary: atomText{Type: "text", Value: post.Description},
+			Content: atomText{Type: "html", Value: postContent(post)},
+		}
+		if !post.Date.IsZero() {
+			entry.Published = post.Date.UTC().Format(time.RFC3339)
+			entry.Updated = post.LastModified().UTC().Format(time.RFC3339)
+		} else {
+			entry.Updated = feed.Updated
+		}
+		if post.Author != "" {
+			entry.Author = &atomPerson{Name: post.Author}
+		}
+		for _, tag := range post.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: normalizeTag(tag)})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalFeed(feed)
+}
+
+// buildJSONFeed renders src as a JSON Feed 1.1 document
+func buildJSONFeed(src feedSource, selfURL string) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       src.Title,
+		HomePageURL: src.PageURL,
+		FeedURL:     selfURL,
+		Description: src.Description,
+		Language:    "en",
+		Items:       []jsonFeedItem{},
+	}
+	for _, post := range src.Posts {
+		item := jsonFeedItem{
+			ID:          postURL(post.Slug),
+			URL:         postURL(post.Slug),
+			Title:       post.Title,
+			ContentHTML: postContent(post),
+			Summary:     post.Description,
+		}
+		if !post.Date.IsZero() {
+			item.DatePublished = post.Date.Format(time.RFC3339)
+		}
+		if !post.Updated.IsZero() {
+			item.DateModified = post.Updated.Format(time.RFC3339)
+		}
+		if post.Author != "" {
+			item.Authors = []jsonFeedAuthor{{Name: post.Author}}
+		}
+		for _, tag := range post.Tags {
+			item.Tags = append(item.Tags, normalizeTag(tag))
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+func marshalFeed(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// feedHandler serves a feed built by build, honouring conditional requests
+func feedHandler(contentType string, build func(feedSource, string) ([]byte, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		src, ok := newFeedSource(requestSnapshot(c), c.DefaultQuery("filter", "all"), c.Query("value"))
+		if !ok {
+			c.String(http.StatusNotFound, "Feed not found")
+			return
+		}
+		body, err := build(src, siteURL+c.Request.URL.RequestURI())
+		if err != nil {
+			log.Printf("Error building feed %s: %v", c.Request.URL.Path, err)
+			c.String(http.StatusInternalServerError, "Error building feed")
+			return
+		}
+		serveConditional(c, http.StatusOK, contentType, body, src.Updated)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// feedTestRouter serves the three feed formats over searchTestPosts
+func feedTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	useTestStore(t, searchTestPosts())
+	r := gin.New()
+	r.GET("/feed.xml", feedHandler("application/rss+xml; charset=utf-8", buildRSS))
+	r.GET("/atom.xml", feedHandler("application/atom+xml; charset=utf-8", buildAtom))
+	r.GET("/feed.json", feedHandler("application/feed+json; charset=utf-8", buildJSONFeed))
+	return r
+}
+
+func get(r http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRSSFeed(t *testing.T) {
+	r := feedTestRouter(t)
+	w := get(r, "/feed.xml")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/rss+xml; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var feed struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title string `xml:"title"`
+			Self  struct {
+				Href string `xml:"href,attr"`
+			} `xml:"http://www.w3.org/2005/Atom link"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title      string   `xml:"title"`
+				GUID       string   `xml:"guid"`
+				PubDate    string   `xml:"pubDate"`
+				Creator    string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+				Categories []string `xml:"category"`
+				Content    string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Version != "2.0" || feed.Channel.Self.Href != siteURL+"/feed.xml" || feed.Channel.LastBuildDate == "" {
+		t.Errorf("channel = %+v", feed.Channel)
+	}
+	if len(feed.Channel.Items) != 3 {
+		t.Fatalf("%d items, want 3", len(feed.Channel.Items))
+	}
+	first := feed.Channel.Items[0]
+	if first.Title != "Physically Based Rendering" || first.GUID != postURL("pbr") || first.Creator != "Jane Doe" ||
+		first.PubDate != "Sat, 01 Mar 2025 00:00:00 +0000" || first.Content == "" || strings.Join(first.Categories, ",") != "graphics" {
+		t.Errorf("newest item = %+v", first)
+	}
+
+	// Tag filters narrow the feed and name it after the tag
+	w = get(r, "/feed.xml?filter=tag&value=opengl")
+	feed.Channel.Items = nil
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Channel.Items) != 1 || !strings.Contains(feed.Channel.Title, `"OpenGL"`) {
+		t.Errorf("opengl feed = %q with %d items, want the one OpenGL post", feed.Channel.Title, len(feed.Channel.Items))
+	}
+}
+
+func TestAtomFeed(t *testing.T) {
+	r := feedTestRouter(t)
+	w := get(r, "/atom.xml?filter=author&value=jane-doe")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Title   string   `xml:"title"`
+		Updated string   `xml:"updated"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Entries []struct {
+			ID        string `xml:"id"`
+			Published string `xml:"published"`
+			Author    string `xml:"author>name"`
+			Content   struct {
+				Type string `xml:"type,attr"`
+			} `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "CodeNPixel - Posts by Jane Doe" || feed.Updated != "2025-03-01T00:00:00Z" {
+		t.Errorf("feed title %q updated %q", feed.Title, feed.Updated)
+	}
+	if len(feed.Links) != 2 || feed.Links[0].Rel != "self" || feed.Links[0].Href != siteURL+"/atom.xml?filter=author&value=jane-doe" {
+		t.Errorf("links = %+v, want self first", feed.Links)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].ID != postURL("pbr") || feed.Entries[1].ID != postURL("shadow-maps") {
+		t.Fatalf("entries = %+v, want pbr then shadow-maps", feed.Entries)
+	}
+	if e := feed.Entries[0]; e.Author != "Jane Doe" || e.Published != "2025-03-01T00:00:00Z" || e.Content.Type != "html" {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	r := feedTestRouter(t)
+	w := get(r, "/feed.json?filter=category&value=game-dev")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/feed+json; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var feed jsonFeed
+	if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Version != "https://jsonfeed.org/version/1.1" || feed.FeedURL != siteURL+"/feed.json?filter=category&value=game-dev" || feed.HomePageURL != siteURL+"/category/game-dev" {
+		t.Errorf("feed = %+v", feed)
+	}
+	if len(feed.Items) != 2 {
+		t.Fatalf("%d items, want the 2 Game Dev posts", len(feed.Items))
+	}
+	item := feed.Items[1]
+	if item.ID != postURL("shadow-maps") || item.DatePublished != "2025-01-01T00:00:00Z" || len(item.Authors) != 1 || strings.Join(item.Tags, ",") != "graphics,opengl" {
+		t.Errorf("item = %+v", item)
+	}
+}
+
+func TestFeedUnknownFilter(t *testing.T) {
+	r := feedTestRouter(t)
+	for _, target := range []string{"/feed.xml?filter=tag&value=cobol", "/atom.xml?filter=category&value=nope", "/feed.json?filter=author&value=nobody"} {
+		if w := get(r, target); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want 404", target, w.Code)
+		}
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	r := feedTestRouter(t)
+	for _, target := range []string{"/feed.xml", "/atom.xml", "/feed.json"} {
+		w := get(r, target)
+		etag := w.Header().Get("ETag")
+		if etag == "" || w.Header().Get("Last-Modified") != "Sat, 01 Mar 2025 00:00:00 GMT" {
+			t.Errorf("GET %s: ETag %q, Last-Modified %q", target, etag, w.Header().Get("Last-Modified"))
+			continue
+		}
+		if w := get(r, target, "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("GET %s with its ETag: status = %d, want an empty 304", target, w.Code)
+		}
+		if w := get(r, target, "If-None-Match", `"stale"`); w.Code != http.StatusOK {
+			t.Errorf("GET %s with a stale ETag: status = %d, want 200", target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"html"
+	"io/fs"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// Highlighting modes. In server mode code blocks are tokenized when a post is
+// rendered; in client mode they are left for Prism to highlight in the
+// browser.
+const (
+	highlightServer = "server"
+	highlightClient = "client"
+)
+
+// highlightMode chooses where code blocks are highlighted
+var highlightMode = envOr("HIGHLIGHT", highlightServer)
+
+// validHighlightMode reports whether mode is a known highlighting mode
+func validHighlightMode(mode string) bool {
+	return mode == highlightServer || mode == highlightClient
+}
+
+// codeBlockPattern matches the fenced code blocks emitted by goldmark and
+// pandoc: <pre><code class="language-xxx">…</code></pre>
+var codeBlockPattern = regexp.MustCompile(`(?s)<pre><code class="language-([\w+#-]+)">(.*?)</code></pre>`)
+
+// highlightCode tokenizes every code block in a rendered post body whose
+// language chroma knows, wrapping tokens in the same "token <type>" spans
+// Prism produces so the existing theme styles them. Blocks are marked with
+// data-highlighted so Prism leaves them alone; blocks in unknown languages
+// are left for Prism.
+func highlightCode(body string) string {
+	return codeBlockPattern.ReplaceAllStringFunc(body, func(block string) string {
+		match := codeBlockPattern.FindStringSubmatch(block)
+		language, code := match[1], html.UnescapeString(match[2])
+		lexer := lexers.Get(language)
+		if lexer == nil {
+			return block
+		}
+		iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+		if err != nil {
+			return block
+		}
+
+		var b strings.Builder
+		b.WriteString(`<pre class="language-` + language + `" data-highlighted><code class="language-` + language + `">`)
+		for _, token := range iterator.Tokens() {
+			text := html.EscapeString(token.Value)
+			if class := prismClass(token.Type); class != "" {
+				b.WriteString(`<span class="token ` + class + `">` + text + `</span>`)
+			} else {
+				b.WriteString(text)
+			}
+		}
+		b.WriteString(`</code></pre>`)
+		return b.String()
+	})
+}
+
+// prismClass maps a chroma token type to the Prism token class with the
+// closest meaning, or "" for plain text
+func prismClass(t chroma.TokenType) string {
+	switch t {
+	case chroma.CommentPreproc, chroma.CommentPreprocFile:
+		return "macro property"
+	case chroma.KeywordConstant:
+		return "boolean"
+	case chroma.NameBuiltin, chroma.NameBuiltinPseudo, chroma.KeywordType:
+		return "builtin"
+	case chroma.NameFunction, chroma.NameFunctionMagic:
+		return "function"
+	case chroma.NameClass, chroma.NameNamespace:
+		return "class-name"
+	case chroma.NameConstant:
+		return "constant"
+	case chroma.NameVariable, chroma.NameVariableClass, chroma.NameVariableGlobal, chroma.NameVariableInstance:
+		return "variable"
+	case chroma.NameAttribute:
+		return "attr-name"
+	case chroma.NameTag:
+		return "tag"
+	case chroma.NameProperty:
+		return "property"
+	case chroma.NameDecorator:
+		return "atrule"
+	case chroma.LiteralStringChar:
+		return "char"
+	case chroma.LiteralStringRegex:
+		return "regex"
+	case chroma.GenericInserted:
+		return "inserted"
+	case chroma.GenericDeleted:
+		return "deleted"
+	case chroma.GenericStrong:
+		return "bold"
+	case chroma.GenericEmph:
+		return "italic"
+	}
+	switch {
+	case t.InCategory(chroma.Comment):
+		return "comment"
+	case t.InCategory(chroma.Keyword):
+		return "keyword"
+	case t.InSubCategory(chroma.LiteralString):
+		return "string"
+	case t.InSubCategory(chroma.LiteralNumber):
+		return "number"
+	case t.InCategory(chroma.Operator):
+		return "operator"
+	case t == chroma.Punctuation:
+		return "punctuation"
+	}
+	return ""
+}
+
+// renderedBody is a cached post body and the source file state it was
+// rendered from
+type renderedBody struct {
+	modTime time.Time
+	size    int64
+	html    string
+}
+
+// renderedBodies caches post bodies by source path, so each file is rendered
+// and highlighted once until it changes
+var renderedBodies sync.Map
+
+// cachedBody returns the rendered body of the file at path, calling render
+// only when the file is new or has changed since it was last rendered
+func cachedBody(path string, render func(string) (string, error)) (string, error) {
+	info, err := fs.Stat(siteFS, path)
+	if err != nil {
+		return "", err
+	}
+	if cached, ok := renderedBodies.Load(path); ok {
+		if body := cached.(renderedBody); body.modTime.Equal(info.ModTime()) && body.size == info.Size() {
+			return body.html, nil
+		}
+	}
+	body, err := render(path)
+	if err != nil {
+		return "", err
+	}
+	if highlightMode == highlightServer {
+		body = highlightCode(body)
+	}
+	renderedBodies.Store(path, renderedBody{modTime: info.ModTime(), size: info.Size(), html: body})
+	return body, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"time"
+)
+
+// Message is a single outgoing email
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers holds extra headers such as List-Unsubscribe
+	Headers map[string]string
+}
+
+// Mailer delivers email. The SMTP implementation is used in production;
+// anything else (a log printer, a test fake) can stand in for it.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// smtpMailer sends mail through an SMTP relay, upgrading to STARTTLS when
+// the server offers it
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// logMailer prints messages instead of sending them, for local development
+type logMailer struct{}
+
+// newMailerFromEnv configures SMTP from SMTP_HOST, SMTP_PORT, SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM, falling back to logging when SMTP_HOST is
+// not set
+func newMailerFromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Printf("SMTP_HOST not set, newsletter emails will be logged instead of sent")
+		return logMailer{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "newsletter@codenpixel.com"
+	}
+	m := &smtpMailer{addr: host + ":" + port, from: from}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m
+}
+
+// Send implements Mailer
+func (m *smtpMailer) Send(msg Message) error {
+	data, err := buildMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, envelopeAddress(m.from), []string{msg.To}, data)
+}
+
+// Send implements Mailer
+func (logMailer) Send(msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// envelopeAddress extracts the bare address from a "Name <addr>" string
+func envelopeAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+// buildMessage renders msg as a MIME message, using multipart/alternative
+// when both text and HTML bodies are present
+func buildMessage(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+	}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	var body bytes.Buffer
+	if msg.HTML == "" {
+		headers["Content-Type"] = "text/plain; charset=utf-8"
+		headers["Content-Transfer-Encoding"] = "quoted-printable"
+		if err := writeQuotedPrintable(&body, msg.Text); err != nil {
+			return nil, err
+		}
+	} else {
+		mw := multipart.NewWriter(&body)
+		headers["Content-Type"] = "multipart/alternative; boundary=" + mw.Boundary()
+		for _, part := range []struct{ contentType, content string }{
+			{"text/plain; charset=utf-8", msg.Text},
+			{"text/html; charset=utf-8", msg.HTML},
+		} {
+			w, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := writeQuotedPrintable(w, part.content); err != nil {
+				return nil, err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, headers[k])
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
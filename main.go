@@ -2,28 +2,140 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Post represents the structure of a blog post from posts.json
+// Post represents a blog post loaded from content/ or the legacy posts.json
 type Post struct {
-	Slug         string   `json:"slug"`
-	Title        string   `json:"title"`
-	Description  string   `json:"description"`
-	Author       string   `json:"author"`
-	Date         string   `json:"date"`
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Author      string    `json:"author"`
+	Date        time.Time `json:"date"`
+	// Updated is set when a post was revised after publication
+	Updated time.Time `json:"updated"`
+	// Status is one of the Status* constants; empty means published
+	Status string `json:"status"`
+	// PublishAt is when a scheduled post goes live, defaulting to Date
+	PublishAt time.Time `json:"publish_at"`
+	// Series names the multi-part series the post belongs to, ordered by
+	// SeriesPart and then by date
+	Series     string `json:"series"`
+	SeriesPart int    `json:"series_part"`
+	// TOC is the table of contents layout, one of the TOC* constants; empty
+	// means the TOC_LAYOUT default
+	TOC          string   `json:"toc"`
 	Tags         []string `json:"tags"`
 	Category     string   `json:"category"`
 	HTMLPath     string   `json:"html_path"`
 	MarkdownPath string   `json:"markdown_path"`
+	// AuthorSlug identifies the resolved author, filled in by the content store
+	AuthorSlug string `json:"-"`
+	// Words counts the body text, filled in when the post is indexed
+	Words int `json:"-"`
+	// ContentFile is the front matter file the post was parsed from, empty
+	// for posts.json entries
+	ContentFile string `json:"-"`
+}
+
+// readingWordsPerMinute is the reading speed assumed for reading times
+const readingWordsPerMinute = 230
+
+// ReadingMinutes estimates how long the post takes to read
+func (p Post) ReadingMinutes() int {
+	return max(1, (p.Words+readingWordsPerMinute-1)/readingWordsPerMinute)
+}
+
+// LastModified returns the updated date, or the publication date when the
+// post was never revised
+func (p Post) LastModified() time.Time {
+	if p.Updated.After(p.Date) {
+		return p.Updated
+	}
+	return p.Date
+}
+
+// postJSON is the public JSON form of a post. It omits the server-side
+// content paths, which are only needed when loading posts.json.
+type postJSON struct {
+	Slug        string     `json:"slug"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Author      string     `json:"author"`
+	AuthorSlug  string     `json:"author_slug,omitempty"`
+	Date        time.Time  `json:"date"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	Tags        []string   `json:"tags"`
+	Category    string     `json:"category"`
+	Status      string     `json:"status"`
+	Series      string     `json:"series,omitempty"`
+	SeriesPart  int        `json:"series_part,omitempty"`
+	ReadingTime int        `json:"reading_time"`
+}
+
+// MarshalJSON writes the public form of the post
+func (p Post) MarshalJSON() ([]byte, error) {
+	out := postJSON{p.Slug, p.Title, p.Description, p.Author, p.AuthorSlug, p.Date, nil, p.Tags, p.Category, p.Status, p.Series, p.SeriesPart, p.ReadingMinutes()}
+	if !p.Updated.IsZero() {
+		out.Updated = &p.Updated
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads a posts.json entry, accepting any of the dateFormats
+func (p *Post) UnmarshalJSON(data []byte) error {
+	type plain Post
+	var raw struct {
+		plain
+		Date      string `json:"date"`
+		Updated   string `json:"updated"`
+		PublishAt string `json:"publish_at"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*p = Post(raw.plain)
+	var err error
+	if p.Date, err = parseDate(raw.Date); err != nil {
+		return fmt.Errorf("post %q: date: %w", p.Slug, err)
+	}
+	if raw.Updated != "" {
+		if p.Updated, err = parseDate(raw.Updated); err != nil {
+			return fmt.Errorf("post %q: updated: %w", p.Slug, err)
+		}
+	}
+	if raw.PublishAt != "" {
+		if p.PublishAt, err = parseDate(raw.PublishAt); err != nil {
+			return fmt.Errorf("post %q: publish_at: %w", p.Slug, err)
+		}
+	}
+	if p.Status == "" {
+		p.Status = StatusPublished
+	}
+	if !validStatus(p.Status) {
+		return fmt.Errorf("post %q: unknown status %q", p.Slug, p.Status)
+	}
+	if !validTOC(p.TOC) {
+		return fmt.Errorf("post %q: unknown toc layout %q", p.Slug, p.TOC)
+	}
+	// Older entries wrap each tag in literal quote characters
+	for i, tag := range p.Tags {
+		p.Tags[i] = strings.Trim(tag, `"`)
+	}
+	return nil
 }
 
 // ResponseError represents an error response structure
@@ -33,30 +145,106 @@ type ResponseError struct {
 
 // Global variables
 var (
-	posts       []Post
-	subscribers []string
-	tmpl        *template.Template
+	contentStore    *ContentStore
+	subscriberStore *SubscriberStore
+	mailer          Mailer
+	// siteURL is the public origin used in emailed links
+	siteURL = envOr("SITE_URL", "https://codenpixel.com")
 )
 
-// loadPosts reads posts from posts.json
-func loadPosts() error {
-	file, err := os.ReadFile("posts.json")
-	if err != nil {
-		log.Printf("Error reading posts.json: %v", err)
-		return err
+// readPosts builds the post list from the content directory, falling back to
+// the legacy posts.json for any slug not found there. A content file that
+// parsed into one of the previous posts but is now invalid keeps that
+// version; other invalid files are left out and returned as skipped. A
+// source that exists but cannot be read, such as a malformed posts.json, is
+// an error.
+func readPosts(previous []Post) (loaded []Post, skipped []error, err error) {
+	sources := 0
+
+	dirPosts, skipped, err := loadContentDir(contentDir)
+	switch {
+	case err == nil:
+		sources++
+		dirPosts, skipped = keepPreviousVersions(dirPosts, skipped, previous)
+		loaded = append(loaded, dirPosts...)
+		log.Printf("Loaded %d posts from %s/", len(dirPosts), contentDir)
+	case os.IsNotExist(err):
+		log.Printf("No %s/ directory, skipping", contentDir)
+	default:
+		return nil, nil, fmt.Errorf("scanning %s/: %w", contentDir, err)
 	}
-	err = json.Unmarshal(file, &posts)
-	if err != nil {
-		log.Printf("Error parsing posts.json: %v", err)
-		return err
+
+	legacy, err := loadLegacyPosts("posts.json")
+	switch {
+	case err == nil:
+		sources++
+		known := make(map[string]bool, len(loaded))
+		for _, post := range loaded {
+			known[post.Slug] = true
+		}
+		added := 0
+		for _, post := range legacy {
+			if known[post.Slug] {
+				continue
+			}
+			loaded = append(loaded, post)
+			added++
+		}
+		log.Printf("Loaded %d posts from posts.json", added)
+	case os.IsNotExist(err):
+		log.Printf("No posts.json, skipping")
+	default:
+		return nil, nil, fmt.Errorf("loading posts.json: %w", err)
 	}
-	log.Printf("Loaded %d posts from posts.json", len(posts))
-	return nil
+
+	if sources == 0 {
+		return nil, nil, fmt.Errorf("no post sources could be loaded from %s/ or posts.json", contentDir)
+	}
+	return loaded, skipped, nil
 }
 
-// loadTemplates loads all HTML templates
-func loadTemplates() error {
-	// var err error
+// keepPreviousVersions carries over the previous version of each post whose
+// content file has turned invalid, rather than unpublishing it until the
+// next good edit. It returns the skipped files it could not cover.
+func keepPreviousVersions(loaded []Post, skipped []error, previous []Post) ([]Post, []error) {
+	byFile := make(map[string]Post)
+	for _, post := range previous {
+		if post.ContentFile != "" {
+			byFile[post.ContentFile] = post
+		}
+	}
+	taken := make(map[string]bool, len(loaded))
+	for _, post := range loaded {
+		taken[post.Slug] = true
+	}
+	var remaining []error
+	for _, err := range skipped {
+		var cerr *ContentError
+		if !errors.As(err, &cerr) {
+			remaining = append(remaining, err)
+			continue
+		}
+		post, ok := byFile[cerr.File]
+		if !ok || taken[post.Slug] {
+			remaining = append(remaining, err)
+			continue
+		}
+		log.Printf("Invalid content file, keeping the previous version of %q: %v", post.Slug, err)
+		loaded = append(loaded, post)
+		taken[post.Slug] = true
+	}
+	return loaded, remaining
+}
+
+// logSkipped reports the content files readPosts left out
+func logSkipped(skipped []error) {
+	for _, err := range skipped {
+		log.Printf("Skipping content file: %v", err)
+	}
+}
+
+// parseTemplates loads all HTML templates into a new template set
+func parseTemplates() (*template.Template, error) {
 	// Define template files with their desired names
 	templateFiles := []struct {
 		path string
@@ -70,76 +258,118 @@ func loadTemplates() error {
 		{path: "templates/partials/newsletter_response.html", name: "newsletter_response"},
 		{path: "templates/partials/post_card.html", name: "post_card"},
 		{path: "templates/partials/meta_data.html", name: "meta_data"},
+		{path: "templates/partials/search_results.html", name: "search_results"},
+		{path: "templates/partials/posts_page.html", name: "posts_page"},
+		{path: "templates/partials/related_posts.html", name: "related_posts"},
+		{path: "templates/partials/toc.html", name: "toc"},
 		{path: "templates/home.html", name: "home.html"},
 		{path: "templates/posts.html", name: "posts.html"},
 		{path: "templates/post.html", name: "post.html"},
+		{path: "templates/newsletter.html", name: "newsletter.html"},
+		{path: "templates/newsletter_manage.html", name: "newsletter_manage.html"},
+		{path: "templates/search.html", name: "search.html"},
+		{path: "templates/author.html", name: "author.html"},
+		{path: "templates/series.html", name: "series.html"},
+		{path: "templates/taxonomy.html", name: "taxonomy.html"},
+		{path: "templates/tags.html", name: "tags.html"},
 	}
 
 	// Create a new template set
-	tmpl = template.New("")
+	funcs := template.FuncMap{"asset": assetPath}
+	set := template.New("").Funcs(funcs)
 
 	// Load each template file with a specific name
 	for _, tf := range templateFiles {
-		t, err := template.ParseFiles(tf.path)
+		t, err := template.New(path.Base(tf.path)).Funcs(funcs).ParseFS(siteFS, tf.path)
 		if err != nil {
 			log.Printf("Error loading template %s: %v", tf.path, err)
-			return err
+			return nil, err
 		}
 		// Rename the template to the desired name
-		tmpl = tmpl.New(tf.name)
-		_, err = tmpl.Parse(string(t.Templates()[0].Tree.Root.String()))
+		set = set.New(tf.name)
+		_, err = set.Parse(string(t.Templates()[0].Tree.Root.String()))
 		if err != nil {
 			log.Printf("Error parsing template %s as %s: %v", tf.path, tf.name, err)
-			return err
+			return nil, err
 		}
 		log.Printf("Successfully loaded template: %s as %s", tf.path, tf.name)
 	}
 
-	return nil
+	return set, nil
 }
 
-// renderTemplate executes a template with the given data and returns the HTML
-
+// renderTemplate executes a template with the given data and returns the
+// HTML. Nothing is returned if execution fails part way, so callers can send
+// an error page instead.
 func renderTemplate(tmpl *template.Template, name string, data interface{}) (string, error) {
 	var buf strings.Builder
 	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
-		log.Printf("Error executing template %s: %v", name, err)
-		// Use error.html as fallback
-		if err := tmpl.ExecuteTemplate(&buf, "error", nil); err != nil {
-			return "", err
-		}
+		return "", err
 	}
 	return buf.String(), nil
 }
 
+// snapshotKey holds the snapshot serving a request in the gin context
+const snapshotKey = "contentSnapshot"
+
+// requestSnapshot returns the snapshot serving this request, taking it on
+// first use so that a reload landing mid-request cannot mix posts or
+// templates from two versions of the site
+func requestSnapshot(c *gin.Context) *ContentSnapshot {
+	if snap, ok := c.Get(snapshotKey); ok {
+		return snap.(*ContentSnapshot)
+	}
+	snap := contentStore.Snapshot()
+	c.Set(snapshotKey, snap)
+	return snap
+}
+
+// renderBase wraps data["CONTENT"] in base.html and sends it with status,
+// sending the error fragment with a 500 instead if the layout fails
+func renderBase(c *gin.Context, status int, data map[string]interface{}) {
+	tmpl := requestSnapshot(c).Templates()
+	page, err := renderTemplate(tmpl, "base.html", data)
+	if err != nil {
+		log.Printf("Error rendering base template: %v", err)
+		content, _ := renderTemplate(tmpl, "error", nil)
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", []byte(page))
+}
+
+// renderPage renders a page template either as an HTMX fragment or wrapped in
+// base.html for a full page load
+func renderPage(c *gin.Context, status int, name string, data map[string]interface{}) {
+	tmpl := requestSnapshot(c).Templates()
+	_, isHXRequest := c.Get("isHXRequest")
+	if isHXRequest {
+		setMetaHeaders(c, data)
+	}
+
+	content, err := renderTemplate(tmpl, name, data)
+	if err != nil {
+		log.Printf("Error rendering %s template: %v", name, err)
+		content, _ := renderTemplate(tmpl, "error", nil)
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
+		return
+	}
+	if isHXRequest {
+		c.Data(status, "text/html; charset=utf-8", []byte(content))
+		return
+	}
+
+	data["CONTENT"] = template.HTML(content)
+	renderBase(c, status, data)
+}
+
 // getPostImageData prepares data for the post_image.html
-func getPostImageData(post Post) map[string]string {
-	icons := map[string]string{
-		"game-loop":             "🎮",
-		"game-engine":           "⚙️",
-		"architecture":          "🏗️",
-		"performance":           "⚡",
-		"real-time":             "⏱️",
-		"opengl":                "🖥️",
-		"graphics-programming":  "🎨",
-		"shaders":               "✨",
-		"rendering":             "🎭",
-		"gpu":                   "💻",
-		"procedural-generation": "🌍",
-		"algorithms":            "🧮",
-		"world-building":        "🏔️",
-		"noise-functions":       "🌊",
-		"game-design":           "🎯",
-		"unreal-engine":         "🚀",
-		"nanite":                "💎",
-		"graphics":              "🎪",
-		"game-development":      "🎲",
-		"3d-rendering":          "🎬",
-	}
-	primaryTag := strings.ToLower(strings.ReplaceAll(post.Tags[0], "\"", ""))
-	icon := icons[primaryTag]
-	if icon == "" {
-		icon = "🔥"
+func getPostImageData(snap *ContentSnapshot, post Post) map[string]string {
+	icon := defaultTermIcon
+	if len(post.Tags) > 0 {
+		if term, ok := snap.Tag(post.Tags[0]); ok && term.Icon != "" {
+			icon = term.Icon
+		}
 	}
 	title := post.Title
 	if len(title) > 50 {
@@ -163,93 +393,177 @@ func getHomeData() map[string]interface{} {
 	}
 }
 
-// getPostsData prepares data for the posts.html
-func getPostsData(filterType, filterValue string) map[string]interface{} {
-	var filteredPosts []Post
+// postCardData prepares data for the post_card.html
+func postCardData(snap *ContentSnapshot, post Post) map[string]interface{} {
+	return map[string]interface{}{
+		"Slug":          post.Slug,
+		"Title":         template.HTMLEscapeString(post.Title),
+		"Description":   template.HTMLEscapeString(post.Description),
+		"Author":        template.HTMLEscapeString(post.Author),
+		"AuthorSlug":    post.AuthorSlug,
+		"FormattedDate": post.Date.Format("Jan 2, 2006"),
+		"Tags":          snap.TagTerms(post.Tags),
+		"Icon":          getPostImageData(snap, post)["Icon"],
+	}
+}
+
+// postCardsData prepares post_card.html data for a list of posts
+func postCardsData(snap *ContentSnapshot, list []Post) []map[string]interface{} {
+	cards := make([]map[string]interface{}, len(list))
+	for i, post := range list {
+		cards[i] = postCardData(snap, post)
+	}
+	return cards
+}
+
+// filterPosts applies the /posts filter=tag|category|author query to the
+// snapshot
+func filterPosts(snap *ContentSnapshot, filterType, filterValue string) []Post {
 	if filterType == "tag" && filterValue != "" {
-		for _, post := range posts {
-			for _, tag := range post.Tags {
-				if strings.ToLower(strings.ReplaceAll(tag, "\"", "")) == strings.ToLower(filterValue) {
-					filteredPosts = append(filteredPosts, post)
-					break
-				}
-			}
-		}
+		return snap.PostsByTag(filterValue)
 	} else if filterType == "category" && filterValue != "" {
-		for _, post := range posts {
-			if strings.ToLower(post.Category) == strings.ToLower(filterValue) {
-				filteredPosts = append(filteredPosts, post)
-			}
-		}
-	} else {
-		filteredPosts = posts
+		return snap.PostsByCategory(filterValue)
+	} else if filterType == "author" && filterValue != "" {
+		return snap.PostsByAuthor(filterValue)
 	}
+	return snap.Posts()
+}
+
+// postsQuery is the filter, sort order and page requested from /posts
+type postsQuery struct {
+	FilterType  string
+	FilterValue string
+	Sort        string
+	Page        int
+	Size        int
+}
+
+// postsSortLabels names the sort orders offered on /posts
+var postsSortLabels = map[string]string{
+	sortNewest:  "Newest",
+	sortOldest:  "Oldest",
+	sortTitle:   "Title",
+	sortReading: "Quick reads",
+	sortLongest: "Long reads",
+}
+
+// getPostsData prepares data for the posts.html
+func getPostsData(snap *ContentSnapshot, q postsQuery) map[string]interface{} {
+	filteredPosts := sortPosts(filterPosts(snap, q.FilterType, q.FilterValue), q.Sort)
+	page := newPage(q.Page, q.Size, len(filteredPosts))
+	q.Page = page.Number
 
 	// Prepare post data with formatted date and tags
-	postsData := make([]map[string]interface{}, len(filteredPosts))
-	for i, post := range filteredPosts {
-		date, _ := time.Parse("2006-01-02", post.Date)
-		postsData[i] = map[string]interface{}{
-			"Slug":          post.Slug,
-			"Title":         template.HTMLEscapeString(post.Title),
-			"Description":   template.HTMLEscapeString(post.Description),
-			"Author":        template.HTMLEscapeString(post.Author),
-			"FormattedDate": date.Format("Jan 2, 2006"),
-			"Tags":          post.Tags,
-			"Icon":          getPostImageData(post)["Icon"],
-		}
-	}
+	postsData := postCardsData(snap, paginate(filteredPosts, page))
 
-	// Generate all tags
-	allTags := make(map[string]bool)
-	for _, post := range posts {
-		for _, tag := range post.Tags {
-			allTags[strings.ReplaceAll(tag, "\"", "")] = true
-		}
-	}
-	tagList := make([]string, 0, len(allTags))
-	for tag := range allTags {
-		tagList = append(tagList, tag)
+	allTags := snap.TagTerms(snap.Tags())
+	tagNames := make([]string, len(allTags))
+	for i, term := range allTags {
+		tagNames[i] = term.Name
 	}
 
-	// Determine title and description
+	// Determine title and description. Tag and category filters redirect to
+	// their own pages before getting here.
 	var title, description string
-	if filterType == "tag" && filterValue != "" {
-		title = fmt.Sprintf(`Posts tagged with "%s" - CodeNPixel`, filterValue)
-		description = fmt.Sprintf(`Explore posts tagged with "%s" on game development and graphics programming at CodeNPixel.`, filterValue)
-	} else if filterType == "category" && filterValue != "" {
-		title = fmt.Sprintf(`%s Posts - CodeNPixel`, filterValue)
-		description = fmt.Sprintf(`Explore %s posts on game development and graphics programming at CodeNPixel.`, filterValue)
+	if author, ok := snap.Author(q.FilterValue); q.FilterType == "author" && ok {
+		title = fmt.Sprintf(`Posts by %s - CodeNPixel`, author.Name)
+		description = fmt.Sprintf(`Explore posts by %s on game development and graphics programming at CodeNPixel.`, author.Name)
 	} else {
 		title = "All Posts - CodeNPixel"
 		description = "Explore all posts on game development and graphics programming at CodeNPixel."
 	}
 
-	return map[string]interface{}{
+	if page.Number > 1 {
+		title = strings.Replace(title, " - CodeNPixel", fmt.Sprintf(" - Page %d - CodeNPixel", page.Number), 1)
+	}
+
+	sortOptions := make([]map[string]interface{}, 0, len(sortOrders))
+	for _, order := range sortOrders {
+		option := q
+		option.Sort, option.Page = order, 1
+		sortOptions = append(sortOptions, map[string]interface{}{
+			"Label":  postsSortLabels[order],
+			"URL":    option.URL(),
+			"Active": order == q.Sort,
+		})
+	}
+
+	data := map[string]interface{}{
 		"Posts":       postsData,
 		"Title":       template.HTMLEscapeString(title),
-		"FilterType":  filterType,
-		"FilterValue": filterValue,
-		"AllTags":     tagList,
+		"FilterType":  q.FilterType,
+		"FilterValue": q.FilterValue,
+		"AllTags":     allTags,
+		"SortOptions": sortOptions,
+		"Page":        page,
 		"TITLE":       title,
 		"DESCRIPTION": description,
-		"KEYWORDS":    strings.Join(tagList, ", "),
+		"KEYWORDS":    strings.Join(tagNames, ", "),
 		"OG_TYPE":     "website",
-		"URL":         fmt.Sprintf("https://codenpixel.com/posts?filter=%s&value=%s", filterType, filterValue),
+		"URL":         siteURL + q.URL(),
 		"OG_IMAGE":    "https://codenpixel.com/public/images/logo.png",
 	}
+	if page.HasPrev() {
+		prev := q
+		prev.Page = page.Prev()
+		data["PrevURL"] = prev.URL()
+	}
+	if page.HasNext() {
+		next := q
+		next.Page = page.Next()
+		data["NextURL"] = next.URL()
+	}
+	return data
 }
 
-// getPostData prepares data for the post.html
-func getPostData(slug string) (map[string]interface{}, *Post, error) {
-	var post *Post
-	for _, p := range posts {
-		if p.Slug == slug {
-			post = &p
-			break
+// postsPerPage is the default number of post cards on each /posts page
+const postsPerPage = 9
+
+// URL builds the /posts address for the query, leaving out defaults
+func (q postsQuery) URL() string {
+	query := url.Values{}
+	if (q.FilterType == "tag" || q.FilterType == "category" || q.FilterType == "author") && q.FilterValue != "" {
+		query.Set("filter", q.FilterType)
+		query.Set("value", q.FilterValue)
+	}
+	if q.Sort != sortNewest {
+		query.Set("sort", q.Sort)
+	}
+	if q.Page > 1 {
+		query.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.Size != postsPerPage {
+		query.Set("per_page", strconv.Itoa(q.Size))
+	}
+	if len(query) == 0 {
+		return "/posts"
+	}
+	return "/posts?" + query.Encode()
+}
+
+// postContent returns the HTML body of a post, preferring the pre-rendered
+// HTMLPath, then the Markdown source, then the description
+func postContent(post Post) string {
+	if post.HTMLPath != "" {
+		html, err := cachedBody(post.HTMLPath, readHTMLFile)
+		if err == nil {
+			return html
+		}
+		log.Printf("Error reading HTML file %s: %v", post.HTMLPath, err)
+	} else if post.MarkdownPath != "" {
+		html, err := cachedBody(post.MarkdownPath, renderMarkdownFile)
+		if err == nil {
+			return html
 		}
+		log.Printf("Error rendering Markdown file %s: %v", post.MarkdownPath, err)
 	}
-	if post == nil {
+	return post.Description
+}
+
+// getPostData prepares data for the post.html
+func getPostData(snap *ContentSnapshot, slug string) (map[string]interface{}, *Post, error) {
+	found, ok := snap.Post(slug)
+	if !ok {
 		return map[string]interface{}{
 			"TITLE":       "Post Not Found - CodeNPixel",
 			"DESCRIPTION": "The requested post was not found.",
@@ -260,41 +574,119 @@ func getPostData(slug string) (map[string]interface{}, *Post, error) {
 		}, nil, fmt.Errorf("post not found")
 	}
 
-	content := post.Description
-	if post.HTMLPath != "" {
-		if data, err := os.ReadFile(post.HTMLPath); err == nil {
-			content = string(data)
-		} else {
-			log.Printf("Error reading HTML file %s: %v", post.HTMLPath, err)
-		}
-	} else if post.MarkdownPath != "" {
-		if data, err := os.ReadFile(post.MarkdownPath); err == nil {
-			content = string(data)
-		} else {
-			log.Printf("Error reading Markdown file %s: %v", post.MarkdownPath, err)
-		}
-	}
+	return postPageData(snap, found), &found, nil
+}
 
-	date, _ := time.Parse("2006-01-02", post.Date)
-	return map[string]interface{}{
+// postPageData prepares post.html data for a post
+func postPageData(snap *ContentSnapshot, post Post) map[string]interface{} {
+	content := postContent(post)
+	layout, toc := postTOC(post, content)
+
+	data := map[string]interface{}{
 		"Slug":          post.Slug,
 		"Title":         template.HTMLEscapeString(post.Title),
 		"Description":   template.HTMLEscapeString(post.Description),
 		"Author":        template.HTMLEscapeString(post.Author),
-		"FormattedDate": date.Format("Jan 2, 2006"),
-		"Tags":          post.Tags,
+		"FormattedDate": post.Date.Format("Jan 2, 2006"),
+		"Tags":          snap.TagTerms(post.Tags),
 		"Content":       template.HTML(content), // Changed: Use template.HTML to prevent escaping
-		"Icon":          getPostImageData(*post)["Icon"],
+		"TOC":           toc,
+		"TOCLayout":     layout,
+		"ReadingTime":   post.ReadingMinutes(),
+		"Icon":          getPostImageData(snap, post)["Icon"],
 		"TITLE":         fmt.Sprintf("%s - CodeNPixel", post.Title),
 		"DESCRIPTION":   post.Description,
 		"KEYWORDS":      strings.Join(post.Tags, ", "),
 		"OG_TYPE":       "article",
 		"URL":           fmt.Sprintf("https://codenpixel.com/post/%s", post.Slug),
 		"OG_IMAGE":      "https://codenpixel.com/public/images/logo.png",
-	}, post, nil
+	}
+	if !post.Updated.IsZero() && post.Updated.After(post.Date) {
+		data["FormattedUpdated"] = post.Updated.Format("Jan 2, 2006")
+	}
+	if post.Status == StatusUnlisted {
+		data["ROBOTS"] = "noindex, follow"
+	}
+
+	article := map[string]interface{}{
+		"@context":         "https://schema.org",
+		"@type":            "BlogPosting",
+		"headline":         post.Title,
+		"description":      post.Description,
+		"datePublished":    post.Date.Format(time.RFC3339),
+		"dateModified":     post.LastModified().Format(time.RFC3339),
+		"mainEntityOfPage": data["URL"],
+		"image":            data["OG_IMAGE"],
+		"keywords":         data["KEYWORDS"],
+	}
+	data["Related"] = postCardsData(snap, snap.Related(post.Slug, relatedLimit))
+	if nav := seriesNav(snap, post); nav != nil {
+		data["Series"] = nav
+		article["isPartOf"] = map[string]interface{}{
+			"@type": "CreativeWorkSeries",
+			"name":  nav["Title"],
+			"url":   Series{Slug: nav["Slug"].(string)}.URL(),
+		}
+		article["position"] = nav["Part"]
+	}
+	if author, ok := snap.Author(post.AuthorSlug); ok {
+		data["AuthorSlug"] = author.Slug
+		data["AUTHOR"] = author.Name
+		data["AUTHOR_URL"] = author.URL()
+		if handle := author.TwitterHandle(); handle != "" {
+			data["TWITTER_CREATOR"] = handle
+		}
+		article["author"] = authorJSONLD(author)
+	}
+	data["JSON_LD"] = article
+	return data
 }
 
 func main() {
+	// Templates, posts and static files come from the binary unless SITE_DIR
+	// names a directory to read them from
+	if err := useSiteDir(os.Getenv("SITE_DIR")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Subcommands run instead of the web server
+	if len(os.Args) > 1 && os.Args[1] == "digest" {
+		if err := runDigestCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "precompress" {
+		if err := runPrecompressCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "preview-link" {
+		if err := runPreviewLinkCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	hotReload := flag.Bool("reload", envBool("RELOAD"), "watch posts and templates and reload them on change (env RELOAD)")
+	dir := flag.String("site-dir", os.Getenv("SITE_DIR"), "read templates, posts and static files from this directory instead of the embedded copy (env SITE_DIR)")
+	flag.Parse()
+
+	// Hot reload watches files on disk, so it implies the working directory
+	// when no site directory is given
+	if *hotReload && *dir == "" {
+		*dir = "."
+	}
+	if err := useSiteDir(*dir); err != nil {
+		log.Fatal(err)
+	}
+	if siteDir == "" {
+		log.Printf("Serving embedded site files")
+	} else {
+		log.Printf("Serving site files from %s", siteDir)
+	}
+
 	// Set Gin to release mode for production
 	gin.SetMode(gin.ReleaseMode)
 
@@ -306,16 +698,63 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Load posts and templates
-	if err := loadPosts(); err != nil {
+	if !validTOC(tocLayout) {
+		log.Fatalf("TOC_LAYOUT must be %s, %s or %s", TOCInline, TOCSidebar, TOCNone)
+	}
+	if !validHighlightMode(highlightMode) {
+		log.Fatalf("HIGHLIGHT must be %s or %s", highlightServer, highlightClient)
+	}
+
+	// Load posts, authors, taxonomy and templates
+	loaded, skipped, err := readPosts(nil)
+	if err != nil {
 		log.Fatal(err)
 	}
-	if err := loadTemplates(); err != nil {
+	logSkipped(skipped)
+	authors, err := loadAuthors(authorsFile)
+	if err != nil {
 		log.Fatal(err)
 	}
+	taxonomy, err := loadTaxonomy(taxonomyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := termCollisions(loaded, taxonomy); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadAssets(); err != nil {
+		log.Fatal(err)
+	}
+	parsed, err := parseTemplates()
+	if err != nil {
+		log.Fatal(err)
+	}
+	contentStore = NewContentStore(loaded, authors, taxonomy, parsed)
+
+	// Newsletter storage and delivery
+	backend, err := newSubscriberBackendFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	subscriberStore, err = NewSubscriberStore(backend)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailer = newMailerFromEnv()
+
+	if *hotReload {
+		if err := startReloader(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Compress text responses, including static files without a
+	// precompressed sibling
+	r.Use(compressResponses())
 
 	// Serve static files
-	r.Static("/public", "./public")
+	r.GET("/public/*filepath", serveStatic(staticDir))
+	r.HEAD("/public/*filepath", serveStatic(staticDir))
 
 	// Middleware to check HX-Request header
 	r.Use(func(c *gin.Context) {
@@ -326,7 +765,8 @@ func main() {
 	})
 
 	// Routes
-	r.GET("/", func(c *gin.Context) {
+	r.GET("/", cachePage(newestPostModified), func(c *gin.Context) {
+		tmpl := requestSnapshot(c).Templates()
 		_, isHXRequest := c.Get("isHXRequest")
 
 		if isHXRequest {
@@ -355,7 +795,7 @@ func main() {
 				"URL":         "https://codenpixel.com",
 				"OG_IMAGE":    "https://codenpixel.com/public/images/logo.png",
 			}
-			tmpl.ExecuteTemplate(c.Writer, "base.html", data)
+			renderBase(c, http.StatusInternalServerError, data)
 			return
 		}
 
@@ -363,19 +803,58 @@ func main() {
 		data := getHomeData()
 		data["CONTENT"] = template.HTML(homeContent)
 
-		if err := tmpl.ExecuteTemplate(c.Writer, "base.html", data); err != nil {
-			log.Printf("Error rendering base template: %v", err)
-			content, _ := renderTemplate(tmpl, "error", nil)
-			c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
-		}
+		renderBase(c, http.StatusOK, data)
 	})
 
 	// Update your /posts route
-	r.GET("/posts", func(c *gin.Context) {
+	r.GET("/posts", cachePage(newestPostModified), func(c *gin.Context) {
+		tmpl := requestSnapshot(c).Templates()
 		_, isHXRequest := c.Get("isHXRequest")
 		filter := c.DefaultQuery("filter", "all")
 		value := c.Query("value")
-		data := getPostsData(filter, value)
+		number, size, err := parsePage(c, postsPerPage, 48)
+		order, sortErr := parseSort(c.Query("sort"), sortNewest)
+		if err == nil {
+			err = sortErr
+		}
+		if err != nil {
+			renderPage(c, http.StatusBadRequest, "not_found", map[string]interface{}{
+				"Icon":        "📄",
+				"Title":       "Invalid Page",
+				"Message":     err.Error(),
+				"ButtonText":  "Browse All Posts",
+				"IsPost":      true,
+				"TITLE":       "Invalid Page - CodeNPixel",
+				"DESCRIPTION": "The requested page does not exist.",
+				"KEYWORDS":    "game development, graphics programming",
+				"OG_TYPE":     "website",
+				"URL":         siteURL + "/posts",
+				"OG_IMAGE":    siteURL + "/public/images/logo.png",
+			})
+			return
+		}
+		// Tag and category listings moved to /tag/:slug and /category/:slug
+		if (filter == kindTag || filter == kindCategory) && value != "" {
+			target := Term{Kind: filter, Slug: slugify(value)}.Path()
+			if number > 1 {
+				target += "?page=" + strconv.Itoa(number)
+			}
+			c.Redirect(http.StatusMovedPermanently, target)
+			return
+		}
+		data := getPostsData(requestSnapshot(c), postsQuery{FilterType: filter, FilterValue: value, Sort: order, Page: number, Size: size})
+
+		// "Load more" requests only need the next cards appended to the grid
+		if c.GetHeader("HX-Target") == "load-more" {
+			content, err := renderTemplate(tmpl, "posts_page", data)
+			if err != nil {
+				log.Printf("Error rendering posts_page template: %v", err)
+				c.String(http.StatusInternalServerError, "Error loading posts")
+				return
+			}
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
+			return
+		}
 
 		if isHXRequest {
 			setMetaHeaders(c, data)
@@ -398,7 +877,7 @@ func main() {
 				"URL":         "https://codenpixel.com/posts",
 				"OG_IMAGE":    "https://codenpixel.com/public/images/logo.png",
 			}
-			tmpl.ExecuteTemplate(c.Writer, "base.html", dataBase)
+			renderBase(c, http.StatusInternalServerError, dataBase)
 			return
 		}
 
@@ -410,18 +889,15 @@ func main() {
 		// Fix: Add CONTENT field to data for non-HTMX requests
 		data["CONTENT"] = template.HTML(content)
 
-		if err := tmpl.ExecuteTemplate(c.Writer, "base.html", data); err != nil {
-			log.Printf("Error rendering base template: %v", err)
-			content, _ := renderTemplate(tmpl, "error", nil)
-			c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
-		}
+		renderBase(c, http.StatusOK, data)
 	})
 
 	// Update your /post/:slug route
-	r.GET("/post/:slug", func(c *gin.Context) {
+	r.GET("/post/:slug", cachePage(postModified), func(c *gin.Context) {
+		tmpl := requestSnapshot(c).Templates()
 		_, isHXRequest := c.Get("isHXRequest")
 		slug := c.Param("slug")
-		data, post, err := getPostData(slug)
+		data, post, err := getPostData(requestSnapshot(c), slug)
 
 		if isHXRequest && err == nil {
 			setMetaHeaders(c, data) // Add this line
@@ -451,14 +927,13 @@ func main() {
 				"TITLE":       "Post Not Found - CodeNPixel",
 				"DESCRIPTION": "The requested post was not found.",
 			}
-			if err := tmpl.ExecuteTemplate(c.Writer, "base.html", dataBase); err != nil {
-				log.Printf("Error rendering base template: %v", err)
-				content, _ := renderTemplate(tmpl, "error", nil)
-				c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
-			}
+			renderBase(c, http.StatusNotFound, dataBase)
 			return
 		}
 
+		if post.Status == StatusUnlisted {
+			c.Header("X-Robots-Tag", "noindex")
+		}
 		content, err := renderTemplate(tmpl, "post.html", data)
 		if err != nil {
 			log.Printf("Error rendering post template: %v", err)
@@ -470,19 +945,12 @@ func main() {
 			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
 			return
 		}
-		dataBase := gin.H{
-			"CONTENT":     template.HTML(content),
-			"TITLE":       fmt.Sprintf("%s - CodeNPixel", post.Title),
-			"DESCRIPTION": post.Description,
-		}
-		if err := tmpl.ExecuteTemplate(c.Writer, "base.html", dataBase); err != nil {
-			log.Printf("Error rendering base template: %v", err)
-			content, _ := renderTemplate(tmpl, "error", nil)
-			c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
-		}
+		data["CONTENT"] = template.HTML(content)
+		renderBase(c, http.StatusOK, data)
 	})
 
-	r.GET("/home", func(c *gin.Context) {
+	r.GET("/home", cachePage(newestPostModified), func(c *gin.Context) {
+		tmpl := requestSnapshot(c).Templates()
 		data := getHomeData()
 		setMetaHeaders(c, data) // Add this line
 
@@ -497,29 +965,24 @@ func main() {
 	})
 
 	r.GET("/api/posts", func(c *gin.Context) {
-		limit := 6
-		if l := c.Query("limit"); l != "" {
-			fmt.Sscanf(l, "%d", &limit)
+		tmpl := requestSnapshot(c).Templates()
+		number, size, err := parsePage(c, 6, apiMaxPerPage, "limit")
+		order, sortErr := parseSort(c.Query("sort"), sortNewest)
+		if err == nil {
+			err = sortErr
 		}
-		if limit > len(posts) {
-			limit = len(posts)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
 		}
-		recentPosts := posts[:limit]
+		snap := requestSnapshot(c)
+		allPosts := sortPosts(snap.Posts(), order)
+		page := newPage(number, size, len(allPosts))
+		recentPosts := paginate(allPosts, page)
+		setPageHeaders(c, page)
 
 		// Prepare post data for rendering
-		postsData := make([]map[string]interface{}, len(recentPosts))
-		for i, post := range recentPosts {
-			date, _ := time.Parse("2006-01-02", post.Date)
-			postsData[i] = map[string]interface{}{
-				"Slug":          post.Slug,
-				"Title":         template.HTMLEscapeString(post.Title),
-				"Description":   template.HTMLEscapeString(post.Description),
-				"Author":        template.HTMLEscapeString(post.Author),
-				"FormattedDate": date.Format("Jan 2, 2006"),
-				"Tags":          post.Tags,
-				"Icon":          getPostImageData(post)["Icon"],
-			}
-		}
+		postsData := postCardsData(snap, recentPosts)
 
 		// Render only the post cards
 		var postsHTML strings.Builder
@@ -534,72 +997,60 @@ func main() {
 		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(postsHTML.String()))
 	})
 
-	r.POST("/newsletter", func(c *gin.Context) {
-		var body struct {
-			Email string `form:"email"`
-		}
-		if err := c.ShouldBind(&body); err != nil || body.Email == "" || !strings.Contains(body.Email, "@") {
-			content, err := renderTemplate(tmpl, "newsletter_response", map[string]string{
-				"Class":   "text-red-500 font-semibold",
-				"Message": "Please enter a valid email address",
-			})
-			if err != nil {
-				log.Printf("Error rendering newsletter response template: %v", err)
-				content, _ := renderTemplate(tmpl, "error", nil)
-				c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
-				return
-			}
-			c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(content))
-			return
-		}
-		for _, sub := range subscribers {
-			if sub == body.Email {
-				content, err := renderTemplate(tmpl, "newsletter_response", map[string]string{
-					"Class":   "text-orange-500 font-semibold",
-					"Message": "You are already subscribed!",
-				})
-				if err != nil {
-					log.Printf("Error rendering newsletter response template: %v", err)
-					content, _ := renderTemplate(tmpl, "error", nil)
-					c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
-					return
-				}
-				c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
-				return
-			}
+	r.POST("/newsletter", handleNewsletterSubscribe)
+	r.GET("/newsletter/confirm", handleNewsletterConfirm)
+	r.GET("/newsletter/unsubscribe", handleNewsletterManage)
+	r.POST("/newsletter/unsubscribe", handleNewsletterUnsubscribe)
+	r.POST("/newsletter/preferences", handleNewsletterPreferences)
+
+	r.GET("/feed.xml", feedHandler("application/rss+xml; charset=utf-8", buildRSS))
+	r.GET("/atom.xml", feedHandler("application/atom+xml; charset=utf-8", buildAtom))
+	r.GET("/feed.json", feedHandler("application/feed+json; charset=utf-8", buildJSONFeed))
+
+	r.GET("/search", handleSearch)
+	r.GET("/author/:slug", handleAuthor)
+	r.GET("/series/:slug", handleSeries)
+	r.GET("/tag/:slug", termHandler(kindTag))
+	r.GET("/category/:slug", termHandler(kindCategory))
+	r.GET("/tags", handleTags)
+	r.GET("/preview/:slug", handlePreview)
+
+	r.GET("/sitemap.xml", handleSitemap)
+	r.GET("/sitemaps/:part", handleSitemapPart)
+	r.GET("/robots.txt", handleRobots)
+
+	r.GET("/api/search", handleSearchAPI)
+
+	r.GET("/api/posts/json", func(c *gin.Context) {
+		allPosts := requestSnapshot(c).Posts()
+		// Without paging parameters every post is returned, as before
+		number, size, err := parsePage(c, max(len(allPosts), 1), max(len(allPosts), apiMaxPerPage))
+		order, sortErr := parseSort(c.Query("sort"), sortNewest)
+		if err == nil {
+			err = sortErr
 		}
-		subscribers = append(subscribers, body.Email)
-		log.Printf("New subscriber: %s", body.Email)
-		content, err := renderTemplate(tmpl, "newsletter_response", map[string]string{
-			"Class":   "text-brand-orange font-bold text-lg",
-			"Message": "Thank you for subscribing!",
-		})
 		if err != nil {
-			log.Printf("Error rendering newsletter response template: %v", err)
-			content, _ := renderTemplate(tmpl, "error", nil)
-			c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
+			c.JSON(http.StatusBadRequest, ResponseError{Error: err.Error()})
 			return
 		}
-		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
-	})
-
-	r.GET("/api/posts/json", func(c *gin.Context) {
-		c.JSON(http.StatusOK, posts)
+		page := newPage(number, size, len(allPosts))
+		setPageHeaders(c, page)
+		c.JSON(http.StatusOK, paginate(sortPosts(allPosts, order), page))
 	})
 
 	r.GET("/api/posts/:slug", func(c *gin.Context) {
-		slug := c.Param("slug")
-		for _, post := range posts {
-			if post.Slug == slug {
-				c.JSON(http.StatusOK, post)
-				return
-			}
+		if post, ok := requestSnapshot(c).Post(c.Param("slug")); ok {
+			c.JSON(http.StatusOK, post)
+			return
 		}
 		c.JSON(http.StatusNotFound, ResponseError{Error: "Post not found"})
 	})
 
+	r.GET("/api/posts/:slug/related", handleRelated)
+
 	// Error handling middleware
 	r.Use(func(c *gin.Context) {
+		tmpl := requestSnapshot(c).Templates()
 		c.Next()
 		if len(c.Errors) > 0 {
 			content, err := renderTemplate(tmpl, "error", nil)
@@ -631,6 +1082,7 @@ func main() {
 
 	// 404 handler
 	r.NoRoute(func(c *gin.Context) {
+		tmpl := requestSnapshot(c).Templates()
 		data := map[string]interface{}{
 			"Icon":        "🔍",
 			"Title":       "Page Not Found",
@@ -674,7 +1126,26 @@ func main() {
 	log.Println("  GET  /api/posts          - Posts HTML (for HTMX)")
 	log.Println("  GET  /api/posts/json     - Posts JSON")
 	log.Println("  GET  /api/posts/:slug    - Single post JSON")
+	log.Println("  GET  /api/posts/:slug/related - Related posts HTML (?limit=)")
+	log.Println("  GET  /author/:slug       - Author profile and posts")
+	log.Println("  GET  /series/:slug       - Series landing page")
+	log.Println("  GET  /tag/:slug          - Posts with a tag")
+	log.Println("  GET  /category/:slug     - Posts in a category")
+	log.Println("  GET  /tags               - Tag and category index")
+	log.Println("  GET  /search?q=          - Full-text search")
+	log.Println("  GET  /preview/:slug      - Signed draft preview (?token=)")
+	log.Println("  GET  /api/search         - Search JSON (?q=&tag=&category=&author=)")
+	log.Println("  GET  /feed.xml           - RSS feed (?filter=tag|category&value=)")
+	log.Println("  GET  /atom.xml           - Atom feed (?filter=tag|category&value=)")
+	log.Println("  GET  /feed.json          - JSON Feed (?filter=tag|category&value=)")
+	log.Println("  GET  /sitemap.xml        - Sitemap (index once over 50,000 URLs)")
+	log.Println("  GET  /robots.txt         - Crawler rules")
+	log.Println("  GET  /public/*filepath    - Static files (fingerprinted names cached immutably)")
 	log.Println("  POST /newsletter         - Newsletter subscription")
+	log.Println("  GET  /newsletter/confirm - Newsletter double opt-in")
+	log.Println("  GET  /newsletter/unsubscribe - Newsletter preferences")
+	log.Println("  POST /newsletter/unsubscribe - Newsletter unsubscribe (RFC 8058)")
+	log.Println("  POST /newsletter/preferences - Newsletter tag preferences")
 	if err := r.Run(":" + port); err != nil {
 		log.Fatal(err)
 	}
@@ -699,3 +1170,18 @@ func setMetaHeaders(c *gin.Context, data map[string]interface{}) {
 
 	c.Header("X-Meta-Data", string(metaJSON))
 }
+
+// envOr reads an environment variable, returning fallback when it is unset
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envBool reads a boolean environment variable, treating unset or invalid
+// values as false
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// useTestSite serves the site from files for the rest of the test
+func useTestSite(t *testing.T, files fstest.MapFS) {
+	t.Helper()
+	previousFS, previousDir := siteFS, siteDir
+	siteFS, siteDir = files, ""
+	t.Cleanup(func() {
+		siteFS, siteDir = previousFS, previousDir
+	})
+}
+
+// useTestStore installs a content store with the embedded templates for the
+// rest of the test
+func useTestStore(t *testing.T, posts []Post) {
+	t.Helper()
+	previousFS := siteFS
+	siteFS = embeddedSite
+	tmpl, err := parseTemplates()
+	siteFS = previousFS
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := contentStore
+	contentStore = NewContentStore(posts, nil, Taxonomy{}, tmpl)
+	t.Cleanup(func() {
+		contentStore = previous
+	})
+}
+
+const testPostsJSON = `[
+	{"slug": "legacy-post", "title": "Legacy Post", "date": "2025-01-02T00:00:00Z", "tags": ["go"]},
+	{"slug": "shared-slug", "title": "Old Copy", "date": "2025-01-01T00:00:00Z"}
+]`
+
+const testContentFile = `---
+title: Shared Slug
+slug: shared-slug
+date: 2025-03-01
+tags: [go, testing]
+---
+Body text.
+`
+
+func slugsOf(posts []Post) string {
+	slugs := make([]string, len(posts))
+	for i, post := range posts {
+		slugs[i] = post.Slug
+	}
+	return strings.Join(slugs, ",")
+}
+
+func TestReadPosts(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       fstest.MapFS
+		wantSlugs   string
+		wantSkipped int
+		wantErr     bool
+	}{
+		{
+			name: "content directory wins over posts.json",
+			files: fstest.MapFS{
+				"posts.json":             {Data: []byte(testPostsJSON)},
+				"content/shared-slug.md": {Data: []byte(testContentFile)},
+			},
+			wantSlugs: "shared-slug,legacy-post",
+		},
+		{
+			name: "invalid content file is skipped and reported",
+			files: fstest.MapFS{
+				"posts.json":        {Data: []byte(testPostsJSON)},
+				"content/broken.md": {Data: []byte("---\ndate: 2025-01-01\n---\nno title\n")},
+			},
+			wantSlugs:   "legacy-post,shared-slug",
+			wantSkipped: 1,
+		},
+		{
+			name: "malformed posts.json is an error",
+			files: fstest.MapFS{
+				"posts.json":             {Data: []byte(`[{"slug": `)},
+				"content/shared-slug.md": {Data: []byte(testContentFile)},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no sources is an error",
+			files:   fstest.MapFS{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestSite(t, tt.files)
+			posts, skipped, err := readPosts(nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readPosts() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := slugsOf(posts); got != tt.wantSlugs {
+				t.Errorf("readPosts() slugs = %s, want %s", got, tt.wantSlugs)
+			}
+			if len(skipped) != tt.wantSkipped {
+				t.Errorf("readPosts() skipped %d files (%v), want %d", len(skipped), skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestReloadKeepsPostsOnError(t *testing.T) {
+	files := fstest.MapFS{
+		"posts.json":             {Data: []byte(testPostsJSON)},
+		"content/shared-slug.md": {Data: []byte(testContentFile)},
+	}
+	useTestSite(t, files)
+	loaded, _, err := readPosts(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useTestStore(t, loaded)
+	want := slugsOf(contentStore.Snapshot().AllPosts())
+
+	files["posts.json"] = &fstest.MapFile{Data: []byte(`[{"slug": `)}
+	reloadContent([]string{"posts.json"})
+	if got := slugsOf(contentStore.Snapshot().AllPosts()); got != want {
+		t.Errorf("after malformed posts.json, posts = %s, want %s", got, want)
+	}
+
+	files["posts.json"] = &fstest.MapFile{Data: []byte(testPostsJSON)}
+	files["content/shared-slug.md"] = &fstest.MapFile{Data: []byte("---\ntitle: [unclosed\n---\n")}
+	reloadContent([]string{"content/shared-slug.md"})
+	post, ok := contentStore.Snapshot().Post("shared-slug")
+	if !ok || post.Title != "Shared Slug" {
+		t.Errorf("after invalid front matter, shared-slug = %+v, %v; want the previous version", post, ok)
+	}
+
+	files["content/shared-slug.md"] = &fstest.MapFile{Data: []byte(strings.Replace(testContentFile, "title: Shared Slug", "title: Edited", 1))}
+	reloadContent([]string{"content/shared-slug.md"})
+	if post, _ := contentStore.Snapshot().Post("shared-slug"); post.Title != "Edited" {
+		t.Errorf("after a valid edit, title = %q, want Edited", post.Title)
+	}
+}
+
+func TestFailedRenderIsNotCached(t *testing.T) {
+	useTestStore(t, nil)
+	tmpl, err := contentStore.Templates().Clone()
+	if err == nil {
+		_, err = tmpl.New("flaky").Parse(`<p>partial</p>{{if .Fail}}{{index . 5}}{{end}}<p>rendered</p>`)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentStore.SetTemplates(tmpl)
+
+	if content, err := renderTemplate(tmpl, "flaky", map[string]interface{}{"Fail": true}); err == nil || content != "" {
+		t.Errorf("renderTemplate() = %q, %v; want no output and an error", content, err)
+	}
+
+	fail := true
+	r := gin.New()
+	r.GET("/flaky", cachePage(newestPostModified), func(c *gin.Context) {
+		renderPage(c, http.StatusOK, "flaky", map[string]interface{}{"Fail": fail})
+	})
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flaky", nil))
+		return w
+	}
+
+	w := get()
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("failed render: status = %d, body = %q; want a 500 without partial output", w.Code, w.Body.String())
+	}
+	fail = false
+	if w := get(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "rendered") {
+		t.Errorf("after the failure, status = %d, body = %q; want the page rendered afresh", w.Code, w.Body.String())
+	}
+}
+
+func TestReloadSkipsFilesAlreadyInvalid(t *testing.T) {
+	files := fstest.MapFS{
+		"content/bad.md": {Data: []byte("---\ntitle: Bad\ndate: 2025-13-40\n---\n")},
+		"content/pub.md": {Data: []byte("---\ntitle: Published\ndate: 2025-03-01\n---\n")},
+	}
+	useTestSite(t, files)
+	loaded, skipped, err := readPosts(nil)
+	if err != nil || len(skipped) != 1 {
+		t.Fatalf("readPosts() = %d skipped, %v; want bad.md skipped", len(skipped), err)
+	}
+	useTestStore(t, loaded)
+
+	// bad.md was never valid, so it does not hold back an edit elsewhere
+	files["content/pub.md"] = &fstest.MapFile{Data: []byte("---\ntitle: Renamed\ndate: 2025-03-01\n---\n")}
+	files["content/new.md"] = &fstest.MapFile{Data: []byte("---\ntitle: New\ndate: 2025-03-02\n---\n")}
+	reloadContent([]string{"content/pub.md", "content/new.md"})
+	snap := contentStore.Snapshot()
+	if post, _ := snap.Post("pub"); post.Title != "Renamed" {
+		t.Errorf("after editing pub.md, title = %q, want Renamed", post.Title)
+	}
+	if got := slugsOf(snap.AllPosts()); !strings.Contains(got, "new") || strings.Contains(got, "bad") {
+		t.Errorf("after reload, posts = %s, want new added and bad still skipped", got)
+	}
+
+	// Breaking a valid file keeps its previous version while the rest of
+	// the reload applies
+	files["content/pub.md"] = &fstest.MapFile{Data: []byte("---\ntitle: Broken\ndate: 2025-02-30\n---\n")}
+	delete(files, "content/new.md")
+	reloadContent([]string{"content/pub.md", "content/new.md"})
+	snap = contentStore.Snapshot()
+	if post, ok := snap.Post("pub"); !ok || post.Title != "Renamed" {
+		t.Errorf("after breaking pub.md, pub = %+v, %v; want the previous version", post, ok)
+	}
+	if _, ok := snap.Post("new"); ok {
+		t.Error("new.md was removed but its post is still served")
+	}
+}
+
+func TestRequestSnapshotIsStable(t *testing.T) {
+	useTestStore(t, []Post{{Slug: "before", Title: "Before", Status: StatusPublished}})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	snap := requestSnapshot(c)
+
+	// A reload landing mid-request does not change what the request sees
+	contentStore.SetPosts([]Post{{Slug: "after", Title: "After", Status: StatusPublished}}, nil, Taxonomy{})
+	if requestSnapshot(c) != snap {
+		t.Fatal("requestSnapshot() changed within a request")
+	}
+	if _, ok := requestSnapshot(c).Post("before"); !ok {
+		t.Error("request lost the post it started with")
+	}
+
+	next, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if _, ok := requestSnapshot(next).Post("after"); !ok {
+		t.Error("the next request does not see the reloaded posts")
+	}
+}
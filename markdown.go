@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// markdown is the shared Markdown renderer used for post bodies.
+// Fenced code blocks are emitted as <pre><code class="language-xxx">,
+// which is what both highlightCode and Prism's autoloader look for.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		extension.Footnote,
+		extension.Typographer,
+	),
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+	),
+	goldmark.WithRendererOptions(
+		// Post bodies are authored by us, so inline HTML is allowed through
+		html.WithUnsafe(),
+	),
+)
+
+// renderMarkdown converts a Markdown document to HTML
+func renderMarkdown(source []byte) (string, error) {
+	var buf bytes.Buffer
+	ctx := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+	if err := markdown.Convert(source, &buf, parser.WithContext(ctx)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// readHTMLFile reads a pre-rendered HTML body from the site files
+func readHTMLFile(path string) (string, error) {
+	data, err := fs.ReadFile(siteFS, path)
+	return string(data), err
+}
+
+// renderMarkdownFile reads and renders a Markdown file from the site files,
+// skipping any front matter block
+func renderMarkdownFile(path string) (string, error) {
+	data, err := fs.ReadFile(siteFS, path)
+	if err != nil {
+		return "", err
+	}
+	return renderMarkdown(stripFrontMatter(data))
+}
+
+// headingIDs generates heading IDs the same way pandoc does, so anchors
+// match the ones already published in output/*.html
+type headingIDs struct {
+	seen map[string]bool
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{seen: make(map[string]bool)}
+}
+
+// Generate implements parser.IDs
+func (h *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	id := headingSlug(string(value))
+	if id == "" {
+		if kind == ast.KindHeading {
+			id = "section"
+		} else {
+			id = "id"
+		}
+	}
+	base := id
+	for i := 1; h.seen[id]; i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	h.seen[id] = true
+	return []byte(id)
+}
+
+// Put implements parser.IDs
+func (h *headingIDs) Put(value []byte) {
+	h.seen[string(value)] = true
+}
+
+// headingSlug applies pandoc's auto_identifiers rules: keep letters,
+// digits, '_', '-' and '.', join the remaining words with '-', lowercase
+// everything and drop anything before the first letter.
+func headingSlug(text string) string {
+	kept := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || r == '_' || r == '-' || r == '.' {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, text)
+	return strings.TrimLeftFunc(strings.Join(strings.Fields(kept), "-"), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestHeadingSlug(t *testing.T) {
+	tests := map[string]string{
+		"Vertex Array Objects (VAOs)":          "vertex-array-objects-vaos",
+		"Entity-Component-System (ECS)":        "entity-component-system-ecs",
+		"Fixed Timestep vs. Variable Timestep": "fixed-timestep-vs.-variable-timestep",
+		"snake_case Names":                     "snake_case-names",
+		"3D Math: A Primer":                    "d-math-a-primer",
+		"  Leading and   repeated spaces ":     "leading-and-repeated-spaces",
+		"C++ & C#":                             "c-c",
+		"Über Straße":                          "über-straße",
+		"Rendu de l’éclairage":                 "rendu-de-léclairage",
+		"2025":                                 "",
+		"!!!":                                  "",
+	}
+	for text, want := range tests {
+		if got := headingSlug(text); got != want {
+			t.Errorf("headingSlug(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestHeadingIDsGenerate(t *testing.T) {
+	ids := newHeadingIDs()
+	ids.Put([]byte("explicit"))
+	var got []string
+	for _, text := range []string{"Conclusion", "Conclusion", "Conclusion", "1999", "Explicit"} {
+		got = append(got, string(ids.Generate([]byte(text), ast.KindHeading)))
+	}
+	want := []string{"conclusion", "conclusion-1", "conclusion-2", "section", "explicit-1"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Generate() = %v, want %v", got, want)
+	}
+}
+
+var publishedHeading = regexp.MustCompile(`(?s)<h[1-6][^>]* id="([^"]*)"[^>]*>(.*?)</h[1-6]>`)
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// TestHeadingIDsMatchPublishedPages checks every heading in the pages pandoc
+// rendered, so existing links to their anchors keep working
+func TestHeadingIDsMatchPublishedPages(t *testing.T) {
+	pages, err := filepath.Glob("output/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Skip("no published pages in output/")
+	}
+	for _, page := range pages {
+		data, err := os.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := newHeadingIDs()
+		for _, match := range publishedHeading.FindAllStringSubmatch(string(data), -1) {
+			text := html.UnescapeString(htmlTag.ReplaceAllString(match[2], ""))
+			if got := string(ids.Generate([]byte(text), ast.KindHeading)); got != match[1] {
+				t.Errorf("%s: heading %q gets id %q, pandoc published %q", page, text, got, match[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Subscriber states
+const (
+	SubscriberPending      = "pending"
+	SubscriberConfirmed    = "confirmed"
+	SubscriberUnsubscribed = "unsubscribed"
+)
+
+// errSubscriberNotFound is returned when updating an unknown address
+var errSubscriberNotFound = errors.New("subscriber not found")
+
+// confirmTokenTTL is how long a double opt-in link stays valid
+const confirmTokenTTL = 72 * time.Hour
+
+// confirmResendCooldown is how long a pending address waits before the form
+// sends it another confirmation link, so the public form cannot be used to
+// flood someone's inbox
+const confirmResendCooldown = 15 * time.Minute
+
+// Subscriber is a newsletter subscription record
+type Subscriber struct {
+	Email          string     `json:"email"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at,omitempty"`
+	UnsubscribedAt *time.Time `json:"unsubscribed_at,omitempty"`
+	// ConfirmationSentAt is when the last confirmation link was emailed
+	ConfirmationSentAt *time.Time `json:"confirmation_sent_at,omitempty"`
+	// Tags limits the newsletter to posts carrying one of these tags; empty
+	// means every post
+	Tags []string `json:"tags,omitempty"`
+}
+
+// WantsPost reports whether the subscriber's tag preferences include post
+func (s Subscriber) WantsPost(post Post) bool {
+	if len(s.Tags) == 0 {
+		return true
+	}
+	for _, want := range s.Tags {
+		for _, tag := range post.Tags {
+			if normalizeTag(tag) == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SubscriberBackend persists subscriber records. Save is called with the
+// full record every time it changes; Load returns the latest version of
+// each record.
+type SubscriberBackend interface {
+	Load() ([]Subscriber, error)
+	Save(sub Subscriber) error
+}
+
+// memoryBackend keeps nothing; subscribers are lost on restart
+type memoryBackend struct{}
+
+func (memoryBackend) Load() ([]Subscriber, error) { return nil, nil }
+func (memoryBackend) Save(Subscriber) error       { return nil }
+
+// jsonlBackend appends every change to a JSON-lines file and replays it on
+// load, so the latest line for an address wins
+type jsonlBackend struct {
+	path string
+}
+
+// Load implements SubscriberBackend
+func (b *jsonlBackend) Load() ([]Subscriber, error) {
+	f, err := os.Open(b.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	latest := map[string]int{}
+	var subs []Subscriber
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var sub Subscriber
+		if err := json.Unmarshal(scanner.Bytes(), &sub); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", b.path, line, err)
+		}
+		key := subscriberKey(sub.Email)
+		if i, ok := latest[key]; ok {
+			subs[i] = sub
+			continue
+		}
+		latest[key] = len(subs)
+		subs = append(subs, sub)
+	}
+	return subs, scanner.Err()
+}
+
+// Save implements SubscriberBackend
+func (b *jsonlBackend) Save(sub Subscriber) error {
+	line, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dataDir holds the subscriber list and digest delivery records, from
+// DATA_DIR. In production it must be on a disk that survives deploys, such
+// as the one render.yaml mounts.
+func dataDir() string {
+	return envOr("DATA_DIR", "data")
+}
+
+// newSubscriberBackendFromEnv picks the backend named by SUBSCRIBER_BACKEND
+// ("file", the default, or "memory"). The file backend writes to
+// SUBSCRIBERS_FILE, defaulting to subscribers.jsonl in the data directory.
+func newSubscriberBackendFromEnv() (SubscriberBackend, error) {
+	switch backend := os.Getenv("SUBSCRIBER_BACKEND"); backend {
+	case "", "file":
+		path := envOr("SUBSCRIBERS_FILE", filepath.Join(dataDir(), "subscribers.jsonl"))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		log.Printf("Storing newsletter subscribers in %s", path)
+		return &jsonlBackend{path: path}, nil
+	case "memory":
+		return memoryBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unknown SUBSCRIBER_BACKEND %q", backend)
+	}
+}
+
+// SubscriberStore keeps newsletter subscribers in memory for fast lookups
+// and writes every change through to its backend. It is safe for
+// concurrent use.
+type SubscriberStore struct {
+	mu      sync.RWMutex
+	backend SubscriberBackend
+	subs    []Subscriber
+	index   map[string]int
+}
+
+// NewSubscriberStore loads existing subscribers from backend
+func NewSubscriberStore(backend SubscriberBackend) (*SubscriberStore, error) {
+	subs, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	s := &SubscriberStore{backend: backend, subs: subs, index: make(map[string]int, len(subs))}
+	for i, sub := range subs {
+		s.index[subscriberKey(sub.Email)] = i
+	}
+	return s, nil
+}
+
+// subscriberKey normalises an address for lookups
+func subscriberKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Get returns the subscriber record for email
+func (s *SubscriberStore) Get(email string) (Subscriber, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.index[subscriberKey(email)]
+	if !ok {
+		return Subscriber{}, false
+	}
+	return s.subs[i], true
+}
+
+// Subscribe records a pending subscription for email. Active records are
+// returned unchanged; a previously unsubscribed address goes back to
+// pending so it has to be confirmed again.
+func (s *SubscriberStore) Subscribe(email string) (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.index[subscriberKey(email)]; ok {
+		sub := s.subs[i]
+		if sub.Status != SubscriberUnsubscribed {
+			return sub, nil
+		}
+		sub.Status = SubscriberPending
+		sub.UnsubscribedAt = nil
+		return sub, s.put(sub)
+	}
+	sub := Subscriber{Email: strings.TrimSpace(email), Status: SubscriberPending, CreatedAt: time.Now().UTC()}
+	return sub, s.put(sub)
+}
+
+// Confirm marks email as confirmed, creating the record if it is missing
+// (the signed token already proves ownership of the address)
+func (s *SubscriberStore) Confirm(email string) (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	sub := Subscriber{Email: strings.TrimSpace(email), CreatedAt: now}
+	if i, ok := s.index[subscriberKey(email)]; ok {
+		sub = s.subs[i]
+		if sub.Status == SubscriberConfirmed {
+			return sub, nil
+		}
+	}
+	sub.Status = SubscriberConfirmed
+	sub.ConfirmedAt = &now
+	return sub, s.put(sub)
+}
+
+// Unsubscribe removes email from the mailing list, keeping the record so
+// the opt-out is remembered
+func (s *SubscriberStore) Unsubscribe(email string) (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[subscriberKey(email)]
+	if !ok {
+		return Subscriber{}, errSubscriberNotFound
+	}
+	sub := s.subs[i]
+	if sub.Status == SubscriberUnsubscribed {
+		return sub, nil
+	}
+	now := time.Now().UTC()
+	sub.Status = SubscriberUnsubscribed
+	sub.UnsubscribedAt = &now
+	return sub, s.put(sub)
+}
+
+// ClaimConfirmation records that a confirmation link is about to be emailed
+// to email at now. It returns false, recording nothing, when one was already
+// sent within confirmResendCooldown.
+func (s *SubscriberStore) ClaimConfirmation(email string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[subscriberKey(email)]
+	if !ok {
+		return false, errSubscriberNotFound
+	}
+	sub := s.subs[i]
+	if sub.ConfirmationSentAt != nil && now.Sub(*sub.ConfirmationSentAt) < confirmResendCooldown {
+		return false, nil
+	}
+	sub.ConfirmationSentAt = &now
+	return true, s.put(sub)
+}
+
+// ReleaseConfirmation undoes a ClaimConfirmation made at claimed whose email
+// could not be sent, so the next attempt is not held back by the cooldown
+func (s *SubscriberStore) ReleaseConfirmation(email string, claimed time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[subscriberKey(email)]
+	if !ok {
+		return errSubscriberNotFound
+	}
+	sub := s.subs[i]
+	if sub.ConfirmationSentAt == nil || !sub.ConfirmationSentAt.Equal(claimed) {
+		return nil
+	}
+	sub.ConfirmationSentAt = nil
+	return s.put(sub)
+}
+
+// SetTags replaces the tag preferences of email
+func (s *SubscriberStore) SetTags(email string, tags []string) (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[subscriberKey(email)]
+	if !ok {
+		return Subscriber{}, errSubscriberNotFound
+	}
+	sub := s.subs[i]
+	sub.Tags = nil
+	for _, tag := range tags {
+		if tag = normalizeTag(strings.TrimSpace(tag)); tag != "" {
+			sub.Tags = append(sub.Tags, tag)
+		}
+	}
+	return sub, s.put(sub)
+}
+
+// List returns a copy of every subscriber record
+func (s *SubscriberStore) List() []Subscriber {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Subscriber(nil), s.subs...)
+}
+
+// put persists sub and updates the in-memory copy; s.mu must be held
+func (s *SubscriberStore) put(sub Subscriber) error {
+	if err := s.backend.Save(sub); err != nil {
+		return err
+	}
+	key := subscriberKey(sub.Email)
+	if i, ok := s.index[key]; ok {
+		s.subs[i] = sub
+		return nil
+	}
+	s.index[key] = len(s.subs)
+	s.subs = append(s.subs, sub)
+	return nil
+}
+
+// validEmail performs a light syntax check on a submitted address
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && strings.Contains(email, "@")
+}
+
+// sendConfirmation emails a double opt-in link to email
+func sendConfirmation(email string) error {
+	link := fmt.Sprintf("%s/newsletter/confirm?token=%s", siteURL, url.QueryEscape(signToken("confirm", email, confirmTokenTTL)))
+	return mailer.Send(Message{
+		To:      email,
+		Subject: "Confirm your CodeNPixel subscription",
+		Text: "Thanks for signing up to the CodeNPixel newsletter!\n\n" +
+			"Please confirm your subscription by opening this link:\n\n" + link + "\n\n" +
+			"If you did not sign up, just ignore this email and you will not hear from us again.\n",
+	})
+}
+
+// manageURL returns the signed link a subscriber uses to change preferences
+// or unsubscribe. It does not expire so it can be printed in every email.
+func manageURL(email string) string {
+	return fmt.Sprintf("%s/newsletter/unsubscribe?token=%s", siteURL, url.QueryEscape(signToken("manage", email, 0)))
+}
+
+// unsubscribeHeaders returns the RFC 2369 and RFC 8058 headers that let mail
+// clients offer one-click unsubscribe
+func unsubscribeHeaders(email string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + manageURL(email) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// newsletterResponse renders the newsletter_response partial
+func newsletterResponse(c *gin.Context, status int, state, class, message string) {
+	tmpl := requestSnapshot(c).Templates()
+	content, err := renderTemplate(tmpl, "newsletter_response", map[string]string{
+		"State":   state,
+		"Class":   class,
+		"Message": message,
+	})
+	if err != nil {
+		log.Printf("Error rendering newsletter response template: %v", err)
+		content, _ := renderTemplate(tmpl, "error", nil)
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(content))
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", []byte(content))
+}
+
+// handleNewsletterSubscribe starts a double opt-in subscription
+func handleNewsletterSubscribe(c *gin.Context) {
+	var body struct {
+		Email string `form:"email"`
+	}
+	if err := c.ShouldBind(&body); err != nil || !validEmail(strings.TrimSpace(body.Email)) {
+		newsletterResponse(c, http.StatusBadRequest, "invalid", "text-red-500 font-semibold", "Please enter a valid email address")
+		return
+	}
+	email := strings.TrimSpace(body.Email)
+
+	sub, err := subscriberStore.Subscribe(email)
+	if err != nil {
+		log.Printf("Error saving subscriber %s: %v", email, err)
+		newsletterResponse(c, http.StatusInternalServerError, "error", "text-red-500 font-semibold", "Something went wrong, please try again later")
+		return
+	}
+	if sub.Status == SubscriberConfirmed {
+		newsletterResponse(c, http.StatusOK, "subscribed", "text-orange-500 font-semibold", "You are already subscribed!")
+		return
+	}
+
+	// New or still pending: (re)send the confirmation link, unless one went
+	// out recently. The response is the same either way.
+	now := time.Now().UTC()
+	claimed, err := subscriberStore.ClaimConfirmation(sub.Email, now)
+	if err != nil {
+		log.Printf("Error saving subscriber %s: %v", sub.Email, err)
+		newsletterResponse(c, http.StatusInternalServerError, "error", "text-red-500 font-semibold", "Something went wrong, please try again later")
+		return
+	}
+	if claimed {
+		if err := sendConfirmation(sub.Email); err != nil {
+			log.Printf("Error sending confirmation to %s: %v", sub.Email, err)
+			if err := subscriberStore.ReleaseConfirmation(sub.Email, now); err != nil {
+				log.Printf("Error saving subscriber %s: %v", sub.Email, err)
+			}
+			newsletterResponse(c, http.StatusInternalServerError, "error", "text-red-500 font-semibold", "We couldn't send the confirmation email, please try again later")
+			return
+		}
+		log.Printf("Pending subscriber: %s", sub.Email)
+	} else {
+		log.Printf("Pending subscriber: %s (confirmation sent recently, not resending)", sub.Email)
+	}
+	newsletterResponse(c, http.StatusOK, "pending", "text-brand-orange font-bold text-lg", "Almost there! Check your inbox to confirm your subscription.")
+}
+
+// handleNewsletterConfirm completes a subscription from an emailed link
+func handleNewsletterConfirm(c *gin.Context) {
+	data := newsletterPageData("/newsletter/confirm")
+
+	email, err := verifyToken(c.Query("token"), "confirm")
+	if err != nil {
+		message := "This confirmation link is not valid."
+		if errors.Is(err, errExpiredToken) {
+			message = "This confirmation link has expired. Please subscribe again to get a new one."
+		}
+		data["State"], data["Class"], data["Message"] = "invalid", "text-red-500 font-semibold", message
+		renderPage(c, http.StatusBadRequest, "newsletter.html", data)
+		return
+	}
+
+	if _, err := subscriberStore.Confirm(email); err != nil {
+		log.Printf("Error confirming subscriber %s: %v", email, err)
+		data["State"], data["Class"], data["Message"] = "error", "text-red-500 font-semibold", "Something went wrong, please try again later"
+		renderPage(c, http.StatusInternalServerError, "newsletter.html", data)
+		return
+	}
+	log.Printf("Confirmed subscriber: %s", email)
+	data["State"], data["Class"], data["Message"] = "confirmed", "text-brand-orange font-bold text-lg", "Your subscription is confirmed. Thanks for reading CodeNPixel!"
+	renderPage(c, http.StatusOK, "newsletter.html", data)
+}
+
+// newsletterPageData returns the meta data shared by the newsletter pages
+func newsletterPageData(path string) map[string]interface{} {
+	return map[string]interface{}{
+		"TITLE":       "Newsletter - CodeNPixel",
+		"DESCRIPTION": "Manage your CodeNPixel newsletter subscription.",
+		"KEYWORDS":    "game development, graphics programming",
+		"OG_TYPE":     "website",
+		"URL":         siteURL + path,
+		"OG_IMAGE":    siteURL + "/public/images/logo.png",
+	}
+}
+
+// manageSubscriber resolves the subscriber behind a manage token, rendering
+// an error page and returning false when that fails
+func manageSubscriber(c *gin.Context) (Subscriber, bool) {
+	email, err := verifyToken(c.Query("token"), "manage")
+	if err == nil {
+		if sub, ok := subscriberStore.Get(email); ok {
+			return sub, true
+		}
+		err = errSubscriberNotFound
+	}
+	status, message := http.StatusBadRequest, "This link is not valid."
+	if errors.Is(err, errSubscriberNotFound) {
+		status, message = http.StatusNotFound, "We couldn't find that subscription."
+	}
+	respondNewsletter(c, status, "invalid", "text-red-500 font-semibold", message)
+	return Subscriber{}, false
+}
+
+// respondNewsletter answers with the bare newsletter_response partial for
+// HTMX requests and the full newsletter page otherwise
+func respondNewsletter(c *gin.Context, status int, state, class, message string) {
+	if _, isHXRequest := c.Get("isHXRequest"); isHXRequest {
+		newsletterResponse(c, status, state, class, message)
+		return
+	}
+	data := newsletterPageData(c.Request.URL.Path)
+	data["State"], data["Class"], data["Message"] = state, class, message
+	renderPage(c, status, "newsletter.html", data)
+}
+
+// handleNewsletterManage shows the unsubscribe and tag preference forms
+func handleNewsletterManage(c *gin.Context) {
+	sub, ok := manageSubscriber(c)
+	if !ok {
+		return
+	}
+	selected := make(map[string]bool, len(sub.Tags))
+	for _, tag := range sub.Tags {
+		selected[tag] = true
+	}
+	data := newsletterPageData("/newsletter/unsubscribe")
+	data["Email"] = sub.Email
+	data["Token"] = c.Query("token")
+	data["Subscribed"] = sub.Status != SubscriberUnsubscribed
+	data["AllTags"] = requestSnapshot(c).Tags()
+	data["Selected"] = selected
+	renderPage(c, http.StatusOK, "newsletter_manage.html", data)
+}
+
+// handleNewsletterUnsubscribe removes a subscriber. It serves both the form
+// on the manage page and RFC 8058 one-click requests from mail clients,
+// which POST "List-Unsubscribe=One-Click" to the List-Unsubscribe URL.
+func handleNewsletterUnsubscribe(c *gin.Context) {
+	sub, ok := manageSubscriber(c)
+	if !ok {
+		return
+	}
+	if _, err := subscriberStore.Unsubscribe(sub.Email); err != nil {
+		log.Printf("Error unsubscribing %s: %v", sub.Email, err)
+		respondNewsletter(c, http.StatusInternalServerError, "error", "text-red-500 font-semibold", "Something went wrong, please try again later")
+		return
+	}
+	log.Printf("Unsubscribed: %s", sub.Email)
+	respondNewsletter(c, http.StatusOK, "unsubscribed", "text-brand-orange font-bold text-lg", "You have been unsubscribed. Sorry to see you go!")
+}
+
+// handleNewsletterPreferences saves the tags a subscriber wants to hear about
+func handleNewsletterPreferences(c *gin.Context) {
+	sub, ok := manageSubscriber(c)
+	if !ok {
+		return
+	}
+	known := map[string]bool{}
+	for _, tag := range requestSnapshot(c).Tags() {
+		known[tag] = true
+	}
+	var tags []string
+	for _, tag := range c.PostFormArray("tags") {
+		if tag = normalizeTag(tag); known[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	if _, err := subscriberStore.SetTags(sub.Email, tags); err != nil {
+		log.Printf("Error saving preferences for %s: %v", sub.Email, err)
+		respondNewsletter(c, http.StatusInternalServerError, "error", "text-red-500 font-semibold", "Something went wrong, please try again later")
+		return
+	}
+	message := "Preferences saved. You'll get every new post."
+	if len(tags) > 0 {
+		message = "Preferences saved. You'll only get posts tagged " + strings.Join(tags, ", ") + "."
+	}
+	respondNewsletter(c, http.StatusOK, "saved", "text-brand-orange font-bold text-lg", message)
+}
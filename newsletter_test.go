@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeMailer records messages instead of sending them
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []Message
+	err  error
+}
+
+// Send implements Mailer
+func (m *fakeMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *fakeMailer) messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
+
+// useTestNewsletter installs an in-memory subscriber store and a fake mailer
+// for the rest of the test, returning the mailer and a router serving the
+// newsletter endpoints
+func useTestNewsletter(t *testing.T) (*fakeMailer, *gin.Engine) {
+	t.Helper()
+	useTestStore(t, nil)
+	store, err := NewSubscriberStore(memoryBackend{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeMailer{}
+	previousStore, previousMailer := subscriberStore, mailer
+	subscriberStore, mailer = store, fake
+	t.Cleanup(func() {
+		subscriberStore, mailer = previousStore, previousMailer
+	})
+
+	r := gin.New()
+	r.POST("/newsletter", handleNewsletterSubscribe)
+	r.GET("/newsletter/confirm", handleNewsletterConfirm)
+	r.POST("/newsletter/unsubscribe", handleNewsletterUnsubscribe)
+	return fake, r
+}
+
+func subscribe(r http.Handler, email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/newsletter", strings.NewReader(url.Values{"email": {email}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+var confirmLinkPattern = regexp.MustCompile(`/newsletter/confirm\?token=(\S+)`)
+
+func TestNewsletterSubscribe(t *testing.T) {
+	fake, r := useTestNewsletter(t)
+
+	if w := subscribe(r, "not-an-address"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid address: status = %d, want 400", w.Code)
+	}
+
+	w := subscribe(r, "reader@example.com")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Check your inbox") {
+		t.Fatalf("subscribe: status = %d, body = %q", w.Code, w.Body.String())
+	}
+	sent := fake.messages()
+	if len(sent) != 1 || sent[0].To != "reader@example.com" || !confirmLinkPattern.MatchString(sent[0].Text) {
+		t.Fatalf("subscribe sent %+v, want one confirmation link", sent)
+	}
+	if sub, _ := subscriberStore.Get("reader@example.com"); sub.Status != SubscriberPending {
+		t.Errorf("status = %q, want %q", sub.Status, SubscriberPending)
+	}
+
+	// Repeated submissions within the cooldown answer the same but send
+	// nothing
+	for i := 0; i < 3; i++ {
+		w := subscribe(r, "Reader@Example.com")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Check your inbox") {
+			t.Errorf("resubscribe: status = %d, body = %q", w.Code, w.Body.String())
+		}
+	}
+	if n := len(fake.messages()); n != 1 {
+		t.Errorf("resubscribing within the cooldown sent %d emails, want 1", n)
+	}
+
+	// Once the cooldown has passed a new link goes out
+	sub, _ := subscriberStore.Get("reader@example.com")
+	past := sub.ConfirmationSentAt.Add(-confirmResendCooldown)
+	subscriberStore.subs[subscriberStore.index["reader@example.com"]].ConfirmationSentAt = &past
+	subscribe(r, "reader@example.com")
+	if n := len(fake.messages()); n != 2 {
+		t.Errorf("resubscribing after the cooldown sent %d emails in total, want 2", n)
+	}
+}
+
+func TestNewsletterSubscribeSendFailure(t *testing.T) {
+	fake, r := useTestNewsletter(t)
+	fake.err = errors.New("relay down")
+	if w := subscribe(r, "reader@example.com"); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+
+	// The failed attempt does not hold back the retry
+	fake.err = nil
+	subscribe(r, "reader@example.com")
+	if n := len(fake.messages()); n != 1 {
+		t.Errorf("retry sent %d emails, want 1", n)
+	}
+}
+
+func TestNewsletterConfirmAndUnsubscribe(t *testing.T) {
+	fake, r := useTestNewsletter(t)
+	subscribe(r, "reader@example.com")
+	match := confirmLinkPattern.FindStringSubmatch(fake.messages()[0].Text)
+	if match == nil {
+		t.Fatal("no confirmation link sent")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/newsletter/confirm?token="+match[1], nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: status = %d", w.Code)
+	}
+	if sub, _ := subscriberStore.Get("reader@example.com"); sub.Status != SubscriberConfirmed || sub.ConfirmedAt == nil {
+		t.Errorf("after confirm, subscriber = %+v", sub)
+	}
+	if w := subscribe(r, "reader@example.com"); !strings.Contains(w.Body.String(), "already subscribed") {
+		t.Errorf("subscribing a confirmed address: body = %q", w.Body.String())
+	}
+
+	for _, token := range []string{"", "garbage", signToken("manage", "reader@example.com", 0), signToken("confirm", "reader@example.com", -time.Hour)} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/newsletter/confirm?token="+url.QueryEscape(token), nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("confirm with token %q: status = %d, want 400", token, w.Code)
+		}
+	}
+
+	// One-click unsubscribe as sent by mail clients (RFC 8058)
+	unsubscribe := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/newsletter/unsubscribe?token="+url.QueryEscape(token), strings.NewReader("List-Unsubscribe=One-Click"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := unsubscribe(signToken("confirm", "reader@example.com", time.Hour)); code != http.StatusBadRequest {
+		t.Errorf("unsubscribe with a confirm token: status = %d, want 400", code)
+	}
+	if code := unsubscribe(signToken("manage", "stranger@example.com", 0)); code != http.StatusNotFound {
+		t.Errorf("unsubscribe unknown address: status = %d, want 404", code)
+	}
+	if code := unsubscribe(signToken("manage", "reader@example.com", 0)); code != http.StatusOK {
+		t.Fatalf("unsubscribe: status = %d", code)
+	}
+	if sub, _ := subscriberStore.Get("reader@example.com"); sub.Status != SubscriberUnsubscribed || sub.UnsubscribedAt == nil {
+		t.Errorf("after unsubscribe, subscriber = %+v", sub)
+	}
+}
+
+func TestSubscriberBackendFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SUBSCRIBER_BACKEND", "")
+	t.Setenv("SUBSCRIBERS_FILE", "")
+	t.Setenv("DATA_DIR", filepath.Join(dir, "disk"))
+	backend, err := newSubscriberBackendFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "disk", "subscribers.jsonl")
+	if file, ok := backend.(*jsonlBackend); !ok || file.path != want {
+		t.Errorf("backend = %#v, want a file backend writing %s", backend, want)
+	}
+	if got, want := digestDir(), filepath.Join(dir, "disk", "digests"); got != want {
+		t.Errorf("digestDir() = %s, want %s", got, want)
+	}
+
+	t.Setenv("SUBSCRIBERS_FILE", filepath.Join(dir, "elsewhere.jsonl"))
+	if backend, err := newSubscriberBackendFromEnv(); err != nil || backend.(*jsonlBackend).path != filepath.Join(dir, "elsewhere.jsonl") {
+		t.Errorf("SUBSCRIBERS_FILE not honoured: %#v, %v", backend, err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageCacheMaxEntries bounds the rendered-page cache. When it fills up the
+// cache starts over, which is cheap next to re-rendering for every request.
+const pageCacheMaxEntries = 1000
+
+// cachedPage is one rendered response
+type cachedPage struct {
+	header       http.Header
+	body         []byte
+	lastModified time.Time
+	// expires is when a scheduled post goes live and the page may change, or
+	// zero when only a reload can change it
+	expires time.Time
+}
+
+// contentType returns the page's Content-Type; handlers that execute
+// base.html straight into the response leave it unset
+func (p cachedPage) contentType() string {
+	if ct := p.header.Get("Content-Type"); ct != "" {
+		return ct
+	}
+	return "text/html; charset=utf-8"
+}
+
+// PageCache holds rendered pages for the content snapshot they were rendered
+// from. Swapping in a new snapshot, on reload, empties it.
+type PageCache struct {
+	mu      sync.Mutex
+	snap    *ContentSnapshot
+	entries map[string]cachedPage
+}
+
+var pageCache = &PageCache{}
+
+// get returns the page cached under key for snap, if it is still fresh
+func (pc *PageCache) get(snap *ContentSnapshot, key string, now time.Time) (cachedPage, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.snap != snap {
+		return cachedPage{}, false
+	}
+	page, ok := pc.entries[key]
+	if ok && !page.expires.IsZero() && !now.Before(page.expires) {
+		delete(pc.entries, key)
+		return cachedPage{}, false
+	}
+	return page, ok
+}
+
+// put caches page under key, dropping pages rendered from older snapshots
+func (pc *PageCache) put(snap *ContentSnapshot, key string, page cachedPage) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.snap != snap || len(pc.entries) >= pageCacheMaxEntries {
+		pc.snap = snap
+		pc.entries = make(map[string]cachedPage)
+	}
+	pc.entries[key] = page
+}
+
+// pageCacheKey identifies a rendering: the path, the query in canonical
+// order, and whether HTMX asked for a fragment and which one
+func pageCacheKey(c *gin.Context) string {
+	_, isHXRequest := c.Get("isHXRequest")
+	mode := "page"
+	if isHXRequest {
+		mode = "hx:" + c.GetHeader("HX-Target")
+	}
+	return mode + " " + c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+}
+
+// captureWriter buffers the response body so it can be cached before it is
+// sent
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// cachePage serves a route from the rendered-page cache, rendering and
+// caching successful responses on a miss. lastModified derives the
+// Last-Modified date from the posts the page shows.
+func cachePage(lastModified func(c *gin.Context, snap *ContentSnapshot) time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snap := requestSnapshot(c)
+		key := pageCacheKey(c)
+		c.Writer.Header().Add("Vary", "HX-Request, HX-Target")
+		c.Header("Cache-Control", "public, no-cache")
+		now := time.Now()
+		if page, ok := pageCache.get(snap, key, now); ok {
+			for name, values := range page.header {
+				c.Writer.Header()[name] = values
+			}
+			serveConditional(c, http.StatusOK, page.contentType(), page.body, page.lastModified)
+			c.Abort()
+			return
+		}
+
+		original := c.Writer
+		capture := &captureWriter{ResponseWriter: original}
+		c.Writer = capture
+		c.Next()
+		c.Writer = original
+
+		if c.Writer.Status() != http.StatusOK {
+			c.Writer.Write(capture.body.Bytes())
+			return
+		}
+		page := cachedPage{
+			header:       c.Writer.Header().Clone(),
+			body:         capture.body.Bytes(),
+			lastModified: lastModified(c, snap),
+			expires:      snap.NextPublish(now),
+		}
+		pageCache.put(snap, key, page)
+		serveConditional(c, http.StatusOK, page.contentType(), page.body, page.lastModified)
+	}
+}
+
+// newestPostModified is the Last-Modified date of listing pages
+func newestPostModified(_ *gin.Context, snap *ContentSnapshot) time.Time {
+	var latest time.Time
+	for _, post := range snap.Posts() {
+		if post.LastModified().After(latest) {
+			latest = post.LastModified()
+		}
+	}
+	return latest
+}
+
+// postModified is the Last-Modified date of a post page
+func postModified(c *gin.Context, snap *ContentSnapshot) time.Time {
+	post, _ := snap.Post(c.Param("slug"))
+	return post.LastModified()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiMaxPerPage caps the page size of the JSON and fragment APIs
+const apiMaxPerPage = 100
+
+// Page describes one page of a paginated listing
+type Page struct {
+	Number     int `json:"page"`
+	Size       int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// newPage clamps number to the last page so a stale link past the end still
+// shows the final results
+func newPage(number, size, total int) Page {
+	pages := max((total+size-1)/size, 1)
+	return Page{Number: min(number, pages), Size: size, Total: total, TotalPages: pages}
+}
+
+// HasPrev reports whether there is a page before this one
+func (p Page) HasPrev() bool { return p.Number > 1 }
+
+// HasNext reports whether there is a page after this one
+func (p Page) HasNext() bool { return p.Number < p.TotalPages }
+
+// Prev returns the previous page number
+func (p Page) Prev() int { return p.Number - 1 }
+
+// Next returns the next page number
+func (p Page) Next() int { return p.Number + 1 }
+
+// Bounds returns the slice range of this page within the full listing
+func (p Page) Bounds() (start, end int) {
+	start = min((p.Number-1)*p.Size, p.Total)
+	return start, min(start+p.Size, p.Total)
+}
+
+// paginate returns the items of list on page p
+func paginate[T any](list []T, p Page) []T {
+	start, end := p.Bounds()
+	return list[start:end]
+}
+
+// parsePage reads and validates the page and per_page query parameters.
+// sizeParams are older spellings of per_page still accepted, such as the
+// "limit" of /api/posts.
+func parsePage(c *gin.Context, defaultSize, maxSize int, sizeParams ...string) (number, size int, err error) {
+	number, size = 1, defaultSize
+	if v := c.Query("page"); v != "" {
+		if number, err = strconv.Atoi(v); err != nil || number < 1 {
+			return 0, 0, errors.New("page must be a positive integer")
+		}
+	}
+	for _, name := range append([]string{"per_page"}, sizeParams...) {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		if size, err = strconv.Atoi(v); err != nil || size < 1 || size > maxSize {
+			return 0, 0, fmt.Errorf("%s must be between 1 and %d", name, maxSize)
+		}
+		break
+	}
+	return number, size, nil
+}
+
+// pageURL returns the request URL with its page parameter set to number
+func pageURL(c *gin.Context, number int) string {
+	query := c.Request.URL.Query()
+	if number > 1 {
+		query.Set("page", strconv.Itoa(number))
+	} else {
+		query.Del("page")
+	}
+	u := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// setPageHeaders advertises the total count and neighbouring pages of an API
+// response
+func setPageHeaders(c *gin.Context, p Page) {
+	c.Header("X-Total-Count", strconv.Itoa(p.Total))
+	var links []string
+	if p.HasPrev() {
+		links = append(links, fmt.Sprintf(`<%s%s>; rel="prev"`, siteURL, pageURL(c, p.Prev())))
+	}
+	if p.HasNext() {
+		links = append(links, fmt.Sprintf(`<%s%s>; rel="next"`, siteURL, pageURL(c, p.Next())))
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
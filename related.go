@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Related-post scoring. Each shared tag and a shared category add a fixed
+// amount; body similarity is the cosine of the TF-IDF vectors, from 0 to 1.
+const (
+	relatedWeightTag      = 1.0
+	relatedWeightCategory = 0.5
+	relatedWeightText     = 3.0
+)
+
+// relatedLimit is how many related posts the post page shows, and
+// relatedMaxLimit caps the limit parameter of the API
+const (
+	relatedLimit    = 3
+	relatedMaxLimit = 12
+)
+
+// RelatedIndex holds a unit-length TF-IDF vector of each post body, in the
+// same order as the snapshot's posts
+type RelatedIndex struct {
+	vectors []map[string]float64
+}
+
+// newRelatedIndex vectorises the bodies already extracted by the search index
+func newRelatedIndex(search *SearchIndex) *RelatedIndex {
+	counts := make([]map[string]float64, len(search.docs))
+	df := map[string]float64{}
+	for i, doc := range search.docs {
+		counts[i] = map[string]float64{}
+		for _, term := range searchTerms(doc.text) {
+			counts[i][term]++
+		}
+		for term := range counts[i] {
+			df[term]++
+		}
+	}
+
+	n := float64(len(search.docs))
+	idx := &RelatedIndex{vectors: make([]map[string]float64, len(counts))}
+	for i, tf := range counts {
+		vector := make(map[string]float64, len(tf))
+		var norm float64
+		for term, count := range tf {
+			// Terms in every post say nothing about similarity
+			weight := (1 + math.Log(count)) * math.Log(n/df[term])
+			if weight > 0 {
+				vector[term] = weight
+				norm += weight * weight
+			}
+		}
+		norm = math.Sqrt(norm)
+		for term := range vector {
+			vector[term] /= norm
+		}
+		idx.vectors[i] = vector
+	}
+	return idx
+}
+
+// similarity is the cosine similarity of the bodies of posts a and b
+func (idx *RelatedIndex) similarity(a, b int) float64 {
+	va, vb := idx.vectors[a], idx.vectors[b]
+	if len(vb) < len(va) {
+		va, vb = vb, va
+	}
+	var dot float64
+	for term, weight := range va {
+		dot += weight * vb[term]
+	}
+	return dot
+}
+
+// Related returns up to n listed posts most like the post with slug, best
+// match first. Posts with nothing in common are left out.
+func (c *ContentSnapshot) Related(slug string, n int) []Post {
+	i, ok := c.bySlug[slug]
+	if !ok {
+		return nil
+	}
+	post := c.posts[i]
+	tags := make(map[string]bool, len(post.Tags))
+	for _, tag := range post.Tags {
+		tags[normalizeTag(tag)] = true
+	}
+	category := slugify(post.Category)
+
+	type candidate struct {
+		post  Post
+		score float64
+	}
+	now := time.Now()
+	var candidates []candidate
+	for j, other := range c.posts {
+		if j == i || !other.Listed(now) {
+			continue
+		}
+		score := relatedWeightText * c.related.similarity(i, j)
+		for _, tag := range other.Tags {
+			if tags[normalizeTag(tag)] {
+				score += relatedWeightTag
+			}
+		}
+		if category != "" && slugify(other.Category) == category {
+			score += relatedWeightCategory
+		}
+		if score > 0 {
+			candidates = append(candidates, candidate{other, score})
+		}
+	}
+	// Ties go to the newer post, which c.posts already lists first
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].score > candidates[b].score
+	})
+
+	out := make([]Post, 0, min(n, len(candidates)))
+	for _, cand := range candidates[:min(n, len(candidates))] {
+		out = append(out, cand.post)
+	}
+	return out
+}
+
+// handleRelated serves /api/posts/:slug/related?limit=, the related_posts
+// partial for lazy-loading below a post
+func handleRelated(c *gin.Context) {
+	limit := relatedLimit
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > relatedMaxLimit {
+			c.String(http.StatusBadRequest, "limit must be between 1 and %d", relatedMaxLimit)
+			return
+		}
+	}
+	snap := requestSnapshot(c)
+	if _, ok := snap.Post(c.Param("slug")); !ok {
+		c.String(http.StatusNotFound, "Post not found")
+		return
+	}
+
+	data := map[string]interface{}{"Related": postCardsData(snap, snap.Related(c.Param("slug"), limit))}
+	content, err := renderTemplate(snap.Templates(), "related_posts", data)
+	if err != nil {
+		log.Printf("Error rendering related posts: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading related posts")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
+}
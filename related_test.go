@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelatedMatchesCategoriesBySlug(t *testing.T) {
+	date := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	useTestStore(t, []Post{
+		{Slug: "shadows", Title: "Shadow Mapping", Description: "Cascaded depth textures.", Category: "Game Dev", Date: date, Status: StatusPublished},
+		{Slug: "ecs", Title: "Entity Systems", Description: "Archetype storage layouts.", Category: "game-dev", Date: date.AddDate(0, 0, 1), Status: StatusPublished},
+		{Slug: "audio", Title: "Spatial Audio", Description: "Reverb zones and occlusion.", Category: "Game Development", Date: date.AddDate(0, 0, 2), Status: StatusPublished},
+		{Slug: "scenes", Title: "Scene Graphs", Description: "Transforms in a hierarchy.", Date: date.AddDate(0, 0, 3), Status: StatusPublished},
+	})
+	snap := contentStore.Snapshot()
+
+	tests := map[string]string{
+		"shadows": "ecs",
+		"ecs":     "shadows",
+		"audio":   "",
+		// Two posts without a category have nothing in common
+		"scenes": "",
+	}
+	for slug, want := range tests {
+		if got := slugsOf(snap.Related(slug, relatedLimit)); got != want {
+			t.Errorf("Related(%q) = %q, want %q", slug, got, want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce batches the burst of events editors emit for a single save
+const reloadDebounce = 250 * time.Millisecond
+
+// startReloader watches posts.json, content/, output/, templates/ and public/
+// in the site directory and reloads posts, templates or assets whenever
+// something relevant changes
+func startReloader() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// posts.json lives at the top of the site directory, which fsnotify can
+	// only watch as a whole
+	if err := watcher.Add(siteDir); err != nil {
+		watcher.Close()
+		return err
+	}
+	for _, dir := range watchedTrees() {
+		if err := watchTree(watcher, filepath.Join(siteDir, dir)); err != nil && !os.IsNotExist(err) {
+			watcher.Close()
+			return err
+		}
+	}
+	go runReloader(watcher)
+	log.Printf("Hot reload enabled, watching posts.json, %s/, output/, templates/ and %s/ in %s", contentDir, staticDir, siteDir)
+	return nil
+}
+
+// watchTree adds dir and all of its subdirectories to the watcher
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// runReloader collects file events and triggers a reload once they settle
+func runReloader(watcher *fsnotify.Watcher) {
+	pending := map[string]bool{}
+	timer := time.NewTimer(reloadDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			rel, err := filepath.Rel(siteDir, event.Name)
+			if err != nil {
+				continue
+			}
+			path := filepath.ToSlash(rel)
+			if event.Has(fsnotify.Create) {
+				// New directories (e.g. content/series/) need their own watch
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && isWatchedTree(path) {
+					if err := watchTree(watcher, event.Name); err != nil {
+						log.Printf("Error watching %s: %v", event.Name, err)
+					}
+					continue
+				}
+			}
+			if !isReloadTrigger(path) {
+				continue
+			}
+			pending[path] = true
+			timer.Reset(reloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error: %v", err)
+		case <-timer.C:
+			changed := make([]string, 0, len(pending))
+			for path := range pending {
+				changed = append(changed, path)
+			}
+			sort.Strings(changed)
+			pending = map[string]bool{}
+			reloadContent(changed)
+		}
+	}
+}
+
+// watchedTrees lists the directories watched recursively
+func watchedTrees() []string {
+	return []string{"templates", contentDir, "output", staticDir}
+}
+
+// isWatchedTree reports whether path is inside one of the watched directories
+func isWatchedTree(path string) bool {
+	for _, dir := range watchedTrees() {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isReloadTrigger filters out editor swap files and anything else that does
+// not affect posts, templates or assets
+func isReloadTrigger(path string) bool {
+	switch {
+	case path == "posts.json", path == authorsFile, path == taxonomyFile:
+		return true
+	case strings.HasPrefix(path, "templates/"), strings.HasPrefix(path, "output/"):
+		return strings.HasSuffix(path, ".html")
+	case strings.HasPrefix(path, contentDir+"/"):
+		return strings.HasSuffix(path, ".md")
+	case strings.HasPrefix(path, staticDir+"/"):
+		ext := filepath.Ext(path)
+		return ext != ".br" && ext != ".gz" && !strings.HasSuffix(path, "~") && !strings.HasPrefix(filepath.Base(path), ".")
+	}
+	return false
+}
+
+// reloadContent reparses whatever the changed files feed into and swaps the
+// result into the content store. If parsing fails the previous version keeps
+// being served.
+func reloadContent(changed []string) {
+	var reloadPosts, reloadTemplates, reloadAssets bool
+	for _, path := range changed {
+		switch {
+		case strings.HasPrefix(path, "templates/"):
+			reloadTemplates = true
+		case strings.HasPrefix(path, staticDir+"/"):
+			// Pages link to assets by fingerprint, so they are rendered again
+			reloadAssets, reloadTemplates = true, true
+		default:
+			reloadPosts = true
+		}
+	}
+	log.Printf("Change detected in %s", strings.Join(changed, ", "))
+
+	var (
+		newPosts   []Post
+		newAuthors []Author
+		newTerms   Taxonomy
+		newTmpl    *template.Template
+	)
+	if reloadPosts {
+		// A post whose file breaks keeps its previous version; files that
+		// were already invalid stay skipped as at boot
+		loaded, skipped, err := readPosts(contentStore.Snapshot().AllPosts())
+		logSkipped(skipped)
+		if err == nil {
+			newAuthors, err = loadAuthors(authorsFile)
+		}
+		if err == nil {
+			newTerms, err = loadTaxonomy(taxonomyFile)
+		}
+		if err == nil {
+			err = termCollisions(loaded, newTerms)
+		}
+		if err != nil {
+			log.Printf("Reload failed, keeping previous posts: %v", err)
+			reloadPosts = false
+		} else {
+			newPosts = loaded
+		}
+	}
+	if reloadAssets {
+		if err := loadAssets(); err != nil {
+			log.Printf("Reload failed, keeping previous asset fingerprints: %v", err)
+		}
+	}
+	if reloadTemplates {
+		parsed, err := parseTemplates()
+		if err != nil {
+			log.Printf("Reload failed, keeping previous templates: %v", err)
+			reloadTemplates = false
+		} else {
+			newTmpl = parsed
+		}
+	}
+	if !reloadPosts && !reloadTemplates {
+		return
+	}
+
+	if reloadPosts {
+		oldPosts := contentStore.SetPosts(newPosts, newAuthors, newTerms)
+		log.Printf("Reloaded %d posts (%s)", len(newPosts), describePostChanges(oldPosts, contentStore.Snapshot().AllPosts()))
+	}
+	if reloadTemplates {
+		contentStore.SetTemplates(newTmpl)
+		log.Printf("Reloaded templates")
+	}
+}
+
+// describePostChanges summarises which slugs were added, removed or edited
+func describePostChanges(before, after []Post) string {
+	old := make(map[string]Post, len(before))
+	for _, post := range before {
+		old[post.Slug] = post
+	}
+	var added, updated []string
+	for _, post := range after {
+		prev, ok := old[post.Slug]
+		switch {
+		case !ok:
+			added = append(added, post.Slug)
+		case !reflect.DeepEqual(prev, post):
+			updated = append(updated, post.Slug)
+		}
+		delete(old, post.Slug)
+	}
+	removed := make([]string, 0, len(old))
+	for slug := range old {
+		removed = append(removed, slug)
+	}
+	sort.Strings(removed)
+
+	var parts []string
+	if len(added) > 0 {
+		parts = append(parts, "added: "+strings.Join(added, ", "))
+	}
+	if len(updated) > 0 {
+		parts = append(parts, "updated: "+strings.Join(updated, ", "))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, "removed: "+strings.Join(removed, ", "))
+	}
+	if len(parts) == 0 {
+		return "no metadata changes"
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Field weights: a match in the title counts for more than one in the body
+const (
+	searchWeightTitle       = 3.0
+	searchWeightTags        = 2.0
+	searchWeightDescription = 1.5
+	searchWeightBody        = 1.0
+)
+
+// searchMaxQuery bounds the query length so a pasted essay can't stall the
+// index
+const searchMaxQuery = 200
+
+// searchStopWords are too common to help ranking
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "in": true, "is": true,
+	"it": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "with": true,
+}
+
+// SearchIndex is an inverted index over the posts of one content snapshot.
+// It is immutable once built, so it is shared by concurrent readers.
+type SearchIndex struct {
+	docs     []searchDoc
+	postings map[string][]searchPosting
+	// terms is the sorted vocabulary, used to expand prefix queries
+	terms  []string
+	avgLen float64
+}
+
+type searchDoc struct {
+	post Post
+	// text is the stripped body used for snippets
+	text   string
+	length float64
+}
+
+type searchPosting struct {
+	doc int
+	// tf is the field-weighted term frequency
+	tf float64
+}
+
+// SearchResult is one ranked match
+type SearchResult struct {
+	Post    Post
+	Score   float64
+	Snippet template.HTML
+}
+
+// newSearchIndex indexes the title, description, tags and body of each post.
+// It also records each post's body word count in posts.
+func newSearchIndex(posts []Post) *SearchIndex {
+	idx := &SearchIndex{
+		docs:     make([]searchDoc, len(posts)),
+		postings: make(map[string][]searchPosting),
+	}
+	var total float64
+	for i := range posts {
+		text := htmlText(postContent(posts[i]))
+		posts[i].Words = len(strings.Fields(text))
+		post := posts[i]
+		freq := map[string]float64{}
+		var length float64
+		add := func(s string, weight float64) {
+			for _, term := range searchTerms(s) {
+				freq[term] += weight
+				length += weight
+			}
+		}
+		add(post.Title, searchWeightTitle)
+		add(post.Description, searchWeightDescription)
+		for _, tag := range post.Tags {
+			add(normalizeTag(tag), searchWeightTags)
+		}
+		add(text, searchWeightBody)
+
+		idx.docs[i] = searchDoc{post: post, text: text, length: length}
+		total += length
+		for term, tf := range freq {
+			idx.postings[term] = append(idx.postings[term], searchPosting{doc: i, tf: tf})
+		}
+	}
+	if len(posts) > 0 {
+		idx.avgLen = total / float64(len(posts))
+	}
+	idx.terms = make([]string, 0, len(idx.postings))
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+	return idx
+}
+
+// Search ranks the posts matching query by BM25. The last query word also
+// matches as a prefix, so live results work while the reader is typing.
+func (idx *SearchIndex) Search(query string) []SearchResult {
+	if len(query) > searchMaxQuery {
+		query = query[:searchMaxQuery]
+	}
+	words := searchTerms(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	scores := map[int]float64{}
+	n := float64(len(idx.docs))
+	for i, word := range words {
+		terms := []string{word}
+		if i == len(words)-1 {
+			terms = idx.expandPrefix(word)
+		}
+		for _, term := range terms {
+			postings := idx.postings[term]
+			df := float64(len(postings))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for _, p := range postings {
+				norm := 1 - bm25B + bm25B*idx.docs[p.doc].length/idx.avgLen
+				scores[p.doc] += idf * p.tf * (bm25K1 + 1) / (p.tf + bm25K1*norm)
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for doc, score := range scores {
+		d := idx.docs[doc]
+		results = append(results, SearchResult{
+			Post:    d.post,
+			Score:   score,
+			Snippet: searchSnippet(d.post.Description, d.text, words),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Post.Slug < results[j].Post.Slug
+	})
+	return results
+}
+
+// expandPrefix returns the indexed terms starting with word. Single letters
+// only match exactly, as they would otherwise match most of the vocabulary.
+func (idx *SearchIndex) expandPrefix(word string) []string {
+	if len(word) < 2 {
+		return []string{word}
+	}
+	var out []string
+	for i := sort.SearchStrings(idx.terms, word); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], word); i++ {
+		out = append(out, idx.terms[i])
+	}
+	return out
+}
+
+// searchTerms lowercases s and splits it into words, dropping stop words
+func searchTerms(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if !searchStopWords[f] {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// htmlText extracts the readable text of an HTML fragment, skipping scripts
+// and styles and collapsing whitespace
+func htmlText(fragment string) string {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var b strings.Builder
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "script" || string(name) == "style" {
+				skip++
+			}
+			b.WriteByte(' ')
+		case html.EndTagToken:
+			if name, _ := z.TagName(); (string(name) == "script" || string(name) == "style") && skip > 0 {
+				skip--
+			}
+			b.WriteByte(' ')
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		}
+	}
+}
+
+// searchSnippetRadius is how much context surrounds the first match
+const searchSnippetRadius = 80
+
+// searchSnippet extracts the passage around the first query word found in
+// the body, falling back to the description, with matches wrapped in <mark>
+func searchSnippet(description, body string, words []string) template.HTML {
+	text := body
+	start, ok := firstMatch(body, words)
+	if !ok {
+		text = description
+		start, _ = firstMatch(description, words)
+	}
+	from, to := max(start-searchSnippetRadius, 0), min(start+searchSnippetRadius*2, len(text))
+	// Widen to word boundaries so the snippet never starts mid-word
+	for from > 0 && text[from-1] != ' ' {
+		from--
+	}
+	for to < len(text) && text[to] != ' ' {
+		to++
+	}
+	snippet := highlightTerms(text[from:to], words)
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(text) {
+		snippet += "…"
+	}
+	return template.HTML(snippet)
+}
+
+// firstMatch returns the byte offset of the earliest word in text that
+// starts with one of words
+func firstMatch(text string, words []string) (int, bool) {
+	best := -1
+	eachWord(text, func(start, end int) {
+		if best < 0 && matchesAny(text[start:end], words) {
+			best = start
+		}
+	})
+	return max(best, 0), best >= 0
+}
+
+// highlightTerms HTML-escapes text and marks the words matching the query
+func highlightTerms(text string, words []string) string {
+	var b strings.Builder
+	last := 0
+	eachWord(text, func(start, end int) {
+		if !matchesAny(text[start:end], words) {
+			return
+		}
+		b.WriteString(template.HTMLEscapeString(text[last:start]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[start:end]))
+		b.WriteString("</mark>")
+		last = end
+	})
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return b.String()
+}
+
+// eachWord calls fn with the byte range of every letter/digit run in text
+func eachWord(text string, fn func(start, end int)) {
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			fn(start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		fn(start, len(text))
+	}
+}
+
+func matchesAny(word string, words []string) bool {
+	word = strings.ToLower(word)
+	for _, w := range words {
+		if strings.HasPrefix(word, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSearch serves /search?q=. Live-search requests that target only the
+// result list get the search_results partial instead of the whole page.
+func handleSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	snap := requestSnapshot(c)
+	results := make([]map[string]interface{}, 0)
+	if query != "" {
+		for _, r := range snap.Search(query) {
+			card := postCardData(snap, r.Post)
+			card["Snippet"] = r.Snippet
+			results = append(results, card)
+		}
+	}
+
+	data := map[string]interface{}{
+		"Query":       query,
+		"Results":     results,
+		"TITLE":       "Search - CodeNPixel",
+		"DESCRIPTION": "Search CodeNPixel articles on game development and graphics programming.",
+		"KEYWORDS":    "game development, graphics programming, search",
+		"OG_TYPE":     "website",
+		"URL":         siteURL + "/search",
+		"OG_IMAGE":    siteURL + "/public/images/logo.png",
+	}
+	if query != "" {
+		data["TITLE"] = query + " - Search - CodeNPixel"
+	}
+
+	if c.GetHeader("HX-Target") == "search-results" {
+		content, err := renderTemplate(snap.Templates(), "search_results", data)
+		if err != nil {
+			log.Printf("Error rendering search results: %v", err)
+			c.String(http.StatusInternalServerError, "Error rendering search results")
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
+		return
+	}
+	renderPage(c, http.StatusOK, "search.html", data)
+}
+
+// searchHit is one ranked result in the /api/search response
+type searchHit struct {
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Author      string    `json:"author"`
+	AuthorSlug  string    `json:"author_slug,omitempty"`
+	Date        time.Time `json:"date"`
+	Tags        []string  `json:"tags"`
+	Category    string    `json:"category"`
+	URL         string    `json:"url"`
+	Score       float64   `json:"score"`
+	// Snippet is HTML with the matched words wrapped in <mark>
+	Snippet string `json:"snippet"`
+}
+
+// facetCount is the number of hits sharing one tag, category or author.
+// Value is the slug to filter by and Name the display name.
+type facetCount struct {
+	Value string `json:"value"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// facetTally counts hits per slug, remembering a display name for each
+type facetTally map[string]*facetCount
+
+func (f facetTally) add(slug, name string) {
+	if slug == "" {
+		return
+	}
+	if entry, ok := f[slug]; ok {
+		entry.Count++
+		return
+	}
+	f[slug] = &facetCount{Value: slug, Name: name, Count: 1}
+}
+
+type searchResponse struct {
+	Query string `json:"query"`
+	Page
+	Hits   []searchHit             `json:"hits"`
+	Facets map[string][]facetCount `json:"facets"`
+}
+
+// handleSearchAPI serves /api/search?q=&tag=&category=&author=&sort=&page=&per_page=.
+// Filters and facets use the same slugs as the tag, category and author pages,
+// and facets count every filtered hit, not just the current page, so a client
+// can drill down one facet at a time. Hits are
+// ranked by relevance unless a sort order is given. An empty q lists every
+// post.
+func handleSearchAPI(c *gin.Context) {
+	number, size, err := parsePage(c, 20, apiMaxPerPage)
+	order, sortErr := parseSort(c.Query("sort"), "")
+	if err == nil {
+		err = sortErr
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ResponseError{Error: err.Error()})
+		return
+	}
+	query := strings.TrimSpace(c.Query("q"))
+	tag, category, author := slugify(c.Query("tag")), slugify(c.Query("category")), slugify(c.Query("author"))
+	snap := requestSnapshot(c)
+
+	var results []SearchResult
+	if query != "" {
+		results = snap.Search(query)
+	} else {
+		for _, post := range snap.Posts() {
+			results = append(results, SearchResult{
+				Post:    post,
+				Snippet: template.HTML(template.HTMLEscapeString(post.Description)),
+			})
+		}
+	}
+	if order != "" {
+		results = sortResults(results, order)
+	}
+
+	tags, categories, authors := facetTally{}, facetTally{}, facetTally{}
+	resp := searchResponse{Query: query, Hits: []searchHit{}}
+	for _, r := range results {
+		post := r.Post
+		if !matchesFacet(post, tag, category, author) {
+			continue
+		}
+		hit := searchHit{
+			Slug:        post.Slug,
+			Title:       post.Title,
+			Description: post.Description,
+			Author:      post.Author,
+			AuthorSlug:  post.AuthorSlug,
+			Date:        post.Date,
+			Tags:        make([]string, 0, len(post.Tags)),
+			Category:    post.Category,
+			URL:         postURL(post.Slug),
+			Score:       math.Round(r.Score*1000) / 1000,
+			Snippet:     string(r.Snippet),
+		}
+		for _, term := range snap.TagTerms(post.Tags) {
+			hit.Tags = append(hit.Tags, term.Slug)
+			tags.add(term.Slug, term.Name)
+		}
+		if term, ok := snap.Category(post.Category); ok {
+			categories.add(term.Slug, term.Name)
+		}
+		authors.add(post.AuthorSlug, post.Author)
+		resp.Hits = append(resp.Hits, hit)
+	}
+	resp.Page = newPage(number, size, len(resp.Hits))
+	resp.Hits = paginate(resp.Hits, resp.Page)
+	setPageHeaders(c, resp.Page)
+	resp.Facets = map[string][]facetCount{
+		"tags":       facetCounts(tags),
+		"categories": facetCounts(categories),
+		"authors":    facetCounts(authors),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// matchesFacet reports whether post passes the tag, category and author
+// slug filters; empty filters match everything
+func matchesFacet(post Post, tag, category, author string) bool {
+	if category != "" && slugify(post.Category) != category {
+		return false
+	}
+	if author != "" && post.AuthorSlug != author {
+		return false
+	}
+	if tag == "" {
+		return true
+	}
+	for _, t := range post.Tags {
+		if normalizeTag(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// facetCounts orders a tally by frequency, then alphabetically
+func facetCounts(tally facetTally) []facetCount {
+	out := make([]facetCount, 0, len(tally))
+	for _, entry := range tally {
+		out = append(out, *entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+// sortResults reorders search results by a post sort order instead of score
+func sortResults(results []SearchResult, order string) []SearchResult {
+	posts := make([]Post, len(results))
+	bySlug := make(map[string]SearchResult, len(results))
+	for i, r := range results {
+		posts[i] = r.Post
+		bySlug[r.Post.Slug] = r
+	}
+	sorted := make([]SearchResult, 0, len(results))
+	for _, post := range sortPosts(posts, order) {
+		sorted = append(sorted, bySlug[post.Slug])
+	}
+	return sorted
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchTestPosts returns published posts with distinct authors, categories
+// and tags for the search tests
+func searchTestPosts() []Post {
+	date := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []Post{
+		{Slug: "shadow-maps", Title: "Shadow Mapping", Description: "Cascaded shadows for outdoor scenes.", Author: "Jane Doe", Category: "Game Dev", Tags: []string{"Graphics", "OpenGL"}, Date: date, Status: StatusPublished},
+		{Slug: "ecs-intro", Title: "Entity Component Systems", Description: "Data oriented design, with a note on shadow casting components.", Author: "Sam Roe", Category: "Engine Architecture", Tags: []string{"ecs"}, Date: date.AddDate(0, 1, 0), Status: StatusPublished},
+		{Slug: "pbr", Title: "Physically Based Rendering", Description: "Microfacet shading in practice.", Author: "Jane Doe", Category: "game-dev", Tags: []string{"graphics"}, Date: date.AddDate(0, 2, 0), Status: StatusPublished},
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	idx := newSearchIndex(searchTestPosts())
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// A title match outranks a passing mention in the description
+		{"shadow", []string{"shadow-maps", "ecs-intro"}},
+		// The last word matches as a prefix while typing
+		{"microf", []string{"pbr"}},
+		{"the and of", nil},
+		{"nothing-matches", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range idx.Search(tt.query) {
+			got = append(got, r.Post.Slug)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSearchAPIFacets(t *testing.T) {
+	useTestStore(t, searchTestPosts())
+	r := gin.New()
+	r.GET("/api/search", handleSearchAPI)
+
+	search := func(query string) searchResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/search?%s: status = %d", query, w.Code)
+		}
+		var resp searchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := search("")
+	want := map[string][]facetCount{
+		"tags":       {{Value: "graphics", Name: "Graphics", Count: 2}, {Value: "ecs", Name: "ecs", Count: 1}, {Value: "opengl", Name: "OpenGL", Count: 1}},
+		"categories": {{Value: "game-dev", Name: "Game Dev", Count: 2}, {Value: "engine-architecture", Name: "Engine Architecture", Count: 1}},
+		"authors":    {{Value: "jane-doe", Name: "Jane Doe", Count: 2}, {Value: "sam-roe", Name: "Sam Roe", Count: 1}},
+	}
+	for facet, counts := range want {
+		got := resp.Facets[facet]
+		if len(got) != len(counts) {
+			t.Errorf("%s facets = %+v, want %+v", facet, got, counts)
+			continue
+		}
+		for i := range counts {
+			if got[i].Value != counts[i].Value || got[i].Count != counts[i].Count {
+				t.Errorf("%s facets = %+v, want %+v", facet, got, counts)
+				break
+			}
+		}
+	}
+
+	// Filters take the slugs the facets report
+	for _, query := range []string{"author=jane-doe", "category=game-dev", "tag=graphics", "author=Jane+Doe"} {
+		if resp := search(query); resp.Total != 2 {
+			t.Errorf("%s matched %d hits, want 2", query, resp.Total)
+		}
+	}
+	if resp := search("author=jane-doe&tag=opengl"); resp.Total != 1 || resp.Hits[0].Slug != "shadow-maps" {
+		t.Errorf("author and tag filters = %+v, want shadow-maps only", resp.Hits)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Series is an ordered multi-part set of posts
+type Series struct {
+	Slug  string
+	Title string
+	Posts []Post
+}
+
+// URL returns the series landing page address
+func (s Series) URL() string {
+	return fmt.Sprintf("%s/series/%s", siteURL, url.PathEscape(s.Slug))
+}
+
+// seriesOrder sorts parts by SeriesPart, placing unnumbered parts after the
+// numbered ones in date order
+func seriesOrder(posts []Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		switch {
+		case a.SeriesPart != b.SeriesPart && a.SeriesPart != 0 && b.SeriesPart != 0:
+			return a.SeriesPart < b.SeriesPart
+		case (a.SeriesPart == 0) != (b.SeriesPart == 0):
+			return a.SeriesPart != 0
+		}
+		return a.Date.Before(b.Date)
+	})
+}
+
+// seriesNav describes where post sits in its series, for "Part N of M"
+// navigation. Parts that are not listed yet are skipped, unless it is the
+// post itself being previewed.
+func seriesNav(snap *ContentSnapshot, post Post) map[string]interface{} {
+	if post.Series == "" {
+		return nil
+	}
+	series, ok := snap.Series(slugify(post.Series))
+	if !ok {
+		series = Series{Slug: slugify(post.Series), Title: post.Series}
+	}
+	parts := series.Posts
+	index := -1
+	for i, part := range parts {
+		if part.Slug == post.Slug {
+			index = i
+		}
+	}
+	if index < 0 {
+		parts = append(append([]Post(nil), parts...), post)
+		seriesOrder(parts)
+		for i, part := range parts {
+			if part.Slug == post.Slug {
+				index = i
+			}
+		}
+	}
+
+	links := make([]map[string]interface{}, len(parts))
+	for i, part := range parts {
+		links[i] = map[string]interface{}{
+			"Slug":    part.Slug,
+			"Title":   part.Title,
+			"Part":    i + 1,
+			"Current": i == index,
+		}
+	}
+	nav := map[string]interface{}{
+		"Slug":  series.Slug,
+		"Title": series.Title,
+		"Part":  index + 1,
+		"Total": len(parts),
+		"Parts": links,
+	}
+	if index > 0 {
+		nav["Prev"] = links[index-1]
+	}
+	if index < len(parts)-1 {
+		nav["Next"] = links[index+1]
+	}
+	return nav
+}
+
+// handleSeries serves /series/:slug, listing the parts in reading order
+func handleSeries(c *gin.Context) {
+	snap := requestSnapshot(c)
+	series, ok := snap.Series(c.Param("slug"))
+	if !ok {
+		renderPage(c, http.StatusNotFound, "not_found", map[string]interface{}{
+			"Icon":        "📚",
+			"Title":       "Series Not Found",
+			"Message":     "We couldn't find that series.",
+			"ButtonText":  "Browse All Posts",
+			"IsPost":      true,
+			"TITLE":       "Series Not Found - CodeNPixel",
+			"DESCRIPTION": "The requested series was not found.",
+			"KEYWORDS":    "game development, graphics programming",
+			"OG_TYPE":     "website",
+			"URL":         siteURL + c.Request.URL.Path,
+			"OG_IMAGE":    siteURL + "/public/images/logo.png",
+		})
+		return
+	}
+
+	parts := postCardsData(snap, series.Posts)
+	var minutes int
+	var updated time.Time
+	for i, post := range series.Posts {
+		parts[i]["Part"] = i + 1
+		minutes += post.ReadingMinutes()
+		if post.LastModified().After(updated) {
+			updated = post.LastModified()
+		}
+	}
+	renderPage(c, http.StatusOK, "series.html", map[string]interface{}{
+		"Series":       series,
+		"Parts":        parts,
+		"TotalMinutes": minutes,
+		"Updated":      updated.Format("Jan 2, 2006"),
+		"TITLE":        fmt.Sprintf("%s - Series - CodeNPixel", series.Title),
+		"DESCRIPTION":  fmt.Sprintf("%s: a %d-part series on CodeNPixel, starting with %q.", series.Title, len(series.Posts), series.Posts[0].Title),
+		"KEYWORDS":     "game development, graphics programming, series, " + series.Title,
+		"OG_TYPE":      "website",
+		"URL":          series.URL(),
+		"OG_IMAGE":     siteURL + "/public/images/logo.png",
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// embeddedSite is the copy of the templates, posts and static files built
+// into the binary, so a deploy needs nothing next to it
+//
+//go:embed templates public output all:content posts.json authors.json taxonomy.json
+var embeddedSite embed.FS
+
+// siteFS is where templates, posts and static files are read from: the
+// embedded copy, or siteDir when one is given
+var siteFS fs.FS = embeddedSite
+
+// siteDir is the on-disk directory siteFS reads from, or "" when the embedded
+// copy is used
+var siteDir string
+
+// useSiteDir reads the site from dir, or from the embedded copy when dir is
+// empty. Serving from disk lets authors see edits without rebuilding.
+func useSiteDir(dir string) error {
+	if dir == "" {
+		siteDir, siteFS = "", embeddedSite
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("site directory %s is not a directory", dir)
+	}
+	siteDir, siteFS = dir, os.DirFS(dir)
+	return nil
+}
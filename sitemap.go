@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sitemapLimit is the most URLs a single sitemap may list under the
+// sitemaps.org protocol. Larger sites are split and served through an index.
+var sitemapLimit = 50000
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// sitemapEntry is one page in the sitemap
+type sitemapEntry struct {
+	Loc     string
+	LastMod time.Time
+}
+
+// sitemapEntries lists the home page, the post listing, every post, every
+// author, series, tag and category page, and the tag index. Listing pages
+// take the date of their newest post.
+func sitemapEntries(snap *ContentSnapshot) []sitemapEntry {
+	newest := func(list []Post) time.Time {
+		var latest time.Time
+		for _, post := range list {
+			if post.LastModified().After(latest) {
+				latest = post.LastModified()
+			}
+		}
+		return latest
+	}
+
+	all := snap.Posts()
+	entries := []sitemapEntry{
+		{Loc: siteURL + "/", LastMod: newest(all)},
+		{Loc: siteURL + "/posts", LastMod: newest(all)},
+	}
+	for _, post := range all {
+		entries = append(entries, sitemapEntry{Loc: postURL(post.Slug), LastMod: post.LastModified()})
+	}
+	for _, slug := range snap.Tags() {
+		term, _ := snap.Tag(slug)
+		entries = append(entries, sitemapEntry{Loc: term.URL(), LastMod: newest(snap.PostsByTag(slug))})
+	}
+	for _, slug := range snap.Authors() {
+		author, _ := snap.Author(slug)
+		entries = append(entries, sitemapEntry{Loc: author.URL(), LastMod: newest(snap.PostsByAuthor(slug))})
+	}
+	for _, slug := range snap.SeriesSlugs() {
+		series, _ := snap.Series(slug)
+		entries = append(entries, sitemapEntry{Loc: series.URL(), LastMod: newest(series.Posts)})
+	}
+	for _, slug := range snap.Categories() {
+		term, _ := snap.Category(slug)
+		entries = append(entries, sitemapEntry{Loc: term.URL(), LastMod: newest(snap.PostsByCategory(slug))})
+	}
+	if len(snap.Tags()) > 0 {
+		entries = append(entries, sitemapEntry{Loc: siteURL + "/tags", LastMod: newest(all)})
+	}
+	return entries
+}
+
+// sitemapDate formats t as a W3C date, or returns "" for the zero time
+func sitemapDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// buildSitemap renders entries as a urlset
+func buildSitemap(entries []sitemapEntry) ([]byte, time.Time, error) {
+	set := sitemapURLSet{URLs: make([]sitemapURL, 0, len(entries))}
+	var latest time.Time
+	for _, entry := range entries {
+		set.URLs = append(set.URLs, sitemapURL{Loc: entry.Loc, LastMod: sitemapDate(entry.LastMod)})
+		if entry.LastMod.After(latest) {
+			latest = entry.LastMod
+		}
+	}
+	body, err := marshalFeed(set)
+	return body, latest, err
+}
+
+// buildSitemapIndex renders an index pointing at one sitemap per chunk of
+// sitemapLimit entries
+func buildSitemapIndex(entries []sitemapEntry) ([]byte, time.Time, error) {
+	var index sitemapIndex
+	var latest time.Time
+	for i, n := 0, 1; i < len(entries); i, n = i+sitemapLimit, n+1 {
+		var chunkLatest time.Time
+		for _, entry := range entries[i:min(i+sitemapLimit, len(entries))] {
+			if entry.LastMod.After(chunkLatest) {
+				chunkLatest = entry.LastMod
+			}
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapURL{
+			Loc:     fmt.Sprintf("%s/sitemaps/%d.xml", siteURL, n),
+			LastMod: sitemapDate(chunkLatest),
+		})
+		if chunkLatest.After(latest) {
+			latest = chunkLatest
+		}
+	}
+	body, err := marshalFeed(index)
+	return body, latest, err
+}
+
+// handleSitemap serves the whole sitemap, or an index once the site
+// outgrows a single file
+func handleSitemap(c *gin.Context) {
+	entries := sitemapEntries(requestSnapshot(c))
+	build := buildSitemap
+	if len(entries) > sitemapLimit {
+		build = buildSitemapIndex
+	}
+	serveSitemap(c, entries, build)
+}
+
+// handleSitemapPart serves one numbered sitemap listed by the index
+func handleSitemapPart(c *gin.Context) {
+	n, err := strconv.Atoi(strings.TrimSuffix(c.Param("part"), ".xml"))
+	entries := sitemapEntries(requestSnapshot(c))
+	start := (n - 1) * sitemapLimit
+	if err != nil || n < 1 || len(entries) <= sitemapLimit || start >= len(entries) {
+		c.String(http.StatusNotFound, "Sitemap not found")
+		return
+	}
+	serveSitemap(c, entries[start:min(start+sitemapLimit, len(entries))], buildSitemap)
+}
+
+func serveSitemap(c *gin.Context, entries []sitemapEntry, build func([]sitemapEntry) ([]byte, time.Time, error)) {
+	body, lastModified, err := build(entries)
+	if err != nil {
+		log.Printf("Error building sitemap: %v", err)
+		c.String(http.StatusInternalServerError, "Error building sitemap")
+		return
+	}
+	serveConditional(c, http.StatusOK, "application/xml; charset=utf-8", body, lastModified)
+}
+
+// robotsDisallow lists the paths crawlers are asked to skip, configured with
+// a comma-separated ROBOTS_DISALLOW. Set it to "/" to keep a staging site
+// out of search engines.
+var robotsDisallow = envOr("ROBOTS_DISALLOW", "/api/,/newsletter/")
+
+// handleRobots serves robots.txt pointing crawlers at the sitemap
+func handleRobots(c *gin.Context) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	disallowed := false
+	for _, path := range strings.Split(robotsDisallow, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			fmt.Fprintf(&b, "Disallow: %s\n", path)
+			disallowed = true
+		}
+	}
+	if !disallowed {
+		b.WriteString("Disallow:\n")
+	}
+	fmt.Fprintf(&b, "\nSitemap: %s/sitemap.xml\n", siteURL)
+	c.String(http.StatusOK, b.String())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func sitemapTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	useTestStore(t, searchTestPosts())
+	r := gin.New()
+	r.GET("/sitemap.xml", handleSitemap)
+	r.GET("/sitemaps/:part", handleSitemapPart)
+	r.GET("/robots.txt", handleRobots)
+	return r
+}
+
+func TestSitemap(t *testing.T) {
+	r := sitemapTestRouter(t)
+	w := get(r, "/sitemap.xml")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var set sitemapURLSet
+	if err := xml.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	lastmod := map[string]string{}
+	for _, u := range set.URLs {
+		lastmod[u.Loc] = u.LastMod
+	}
+	want := map[string]string{
+		siteURL + "/":                             "2025-03-01",
+		siteURL + "/posts":                        "2025-03-01",
+		postURL("shadow-maps"):                    "2025-01-01",
+		siteURL + "/tag/opengl":                   "2025-01-01",
+		siteURL + "/category/game-dev":            "2025-03-01",
+		siteURL + "/author/sam-roe":               "2025-02-01",
+		siteURL + "/tags":                         "2025-03-01",
+		siteURL + "/category/engine-architecture": "2025-02-01",
+	}
+	for loc, date := range want {
+		if got, ok := lastmod[loc]; !ok || got != date {
+			t.Errorf("sitemap lists %s with lastmod %q (listed: %v), want %q", loc, got, ok, date)
+		}
+	}
+	if len(set.URLs) != len(lastmod) {
+		t.Errorf("sitemap lists %d URLs, %d of them distinct", len(set.URLs), len(lastmod))
+	}
+
+	if w := get(r, "/sitemap.xml", "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status = %d, want 304", w.Code)
+	}
+	// Parts only exist once the sitemap is split
+	if w := get(r, "/sitemaps/1.xml"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /sitemaps/1.xml before splitting: status = %d, want 404", w.Code)
+	}
+}
+
+func TestSitemapIndex(t *testing.T) {
+	r := sitemapTestRouter(t)
+	var whole sitemapURLSet
+	if err := xml.Unmarshal(get(r, "/sitemap.xml").Body.Bytes(), &whole); err != nil {
+		t.Fatal(err)
+	}
+
+	limit := sitemapLimit
+	t.Cleanup(func() { sitemapLimit = limit })
+	sitemapLimit = 5
+	parts := (len(whole.URLs) + sitemapLimit - 1) / sitemapLimit
+	if parts < 2 {
+		t.Fatalf("only %d URLs, too few to split", len(whole.URLs))
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(get(r, "/sitemap.xml").Body.Bytes(), &index); err != nil {
+		t.Fatalf("sitemap.xml is not an index: %v", err)
+	}
+	if len(index.Sitemaps) != parts {
+		t.Fatalf("index lists %d sitemaps, want %d", len(index.Sitemaps), parts)
+	}
+
+	var rejoined []sitemapURL
+	for n, entry := range index.Sitemaps {
+		target := fmt.Sprintf("/sitemaps/%d.xml", n+1)
+		if entry.Loc != siteURL+target || entry.LastMod == "" {
+			t.Errorf("index entry %d = %+v", n, entry)
+		}
+		w := get(r, target)
+		var set sitemapURLSet
+		if err := xml.Unmarshal(w.Body.Bytes(), &set); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("GET %s: status = %d, %v", target, w.Code, err)
+		}
+		if len(set.URLs) > sitemapLimit {
+			t.Errorf("GET %s lists %d URLs, over the limit of %d", target, len(set.URLs), sitemapLimit)
+		}
+		rejoined = append(rejoined, set.URLs...)
+	}
+	if !slices.Equal(rejoined, whole.URLs) {
+		t.Errorf("the parts list %d URLs between them, want the same %d as the whole sitemap", len(rejoined), len(whole.URLs))
+	}
+
+	for _, part := range []string{"0.xml", fmt.Sprintf("%d.xml", parts+1), "first.xml"} {
+		if w := get(r, "/sitemaps/"+part); w.Code != http.StatusNotFound {
+			t.Errorf("GET /sitemaps/%s: status = %d, want 404", part, w.Code)
+		}
+	}
+}
+
+func TestRobots(t *testing.T) {
+	r := sitemapTestRouter(t)
+	disallow := robotsDisallow
+	t.Cleanup(func() { robotsDisallow = disallow })
+
+	tests := map[string]string{
+		"/api/, /newsletter/": "Disallow: /api/\nDisallow: /newsletter/\n",
+		"":                    "Disallow:\n",
+	}
+	for config, rules := range tests {
+		robotsDisallow = config
+		w := get(r, "/robots.txt")
+		want := "User-agent: *\n" + rules + "\nSitemap: " + siteURL + "/sitemap.xml\n"
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("ROBOTS_DISALLOW=%q: status = %d, body =\n%s\nwant\n%s", config, w.Code, w.Body.String(), want)
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+			t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+		}
+	}
+}
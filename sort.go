@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sort orders accepted by the listing pages and APIs
+const (
+	sortNewest  = "newest"
+	sortOldest  = "oldest"
+	sortTitle   = "title"
+	sortReading = "reading" // shortest read first
+	sortLongest = "longest" // longest read first
+)
+
+var sortOrders = []string{sortNewest, sortOldest, sortTitle, sortReading, sortLongest}
+
+// parseSort validates a sort query parameter, returning fallback when it is
+// empty
+func parseSort(value, fallback string) (string, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	for _, order := range sortOrders {
+		if value == order {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("sort must be one of %s", strings.Join(sortOrders, ", "))
+}
+
+// sortPosts returns a copy of list in the given order. Ties keep their
+// existing relative order, which is newest first for snapshot lists. The
+// copy is never nil, so an empty list still encodes as a JSON array.
+func sortPosts(list []Post, order string) []Post {
+	sorted := make([]Post, len(list))
+	copy(sorted, list)
+	var less func(a, b Post) bool
+	switch order {
+	case sortOldest:
+		less = func(a, b Post) bool { return a.Date.Before(b.Date) }
+	case sortTitle:
+		less = func(a, b Post) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case sortReading:
+		less = func(a, b Post) bool { return a.Words < b.Words }
+	case sortLongest:
+		less = func(a, b Post) bool { return a.Words > b.Words }
+	default:
+		less = func(a, b Post) bool { return a.Date.After(b.Date) }
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSortPosts(t *testing.T) {
+	date := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	posts := []Post{
+		{Slug: "b", Title: "beta", Date: date, Words: 900},
+		{Slug: "c", Title: "Gamma", Date: date.AddDate(0, 0, 2), Words: 100},
+		{Slug: "a", Title: "Alpha", Date: date.AddDate(0, 0, 1), Words: 500},
+	}
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{sortNewest, "c,a,b"},
+		{sortOldest, "b,a,c"},
+		{sortTitle, "a,b,c"},
+		{sortReading, "c,a,b"},
+		{sortLongest, "b,a,c"},
+	}
+	for _, tt := range tests {
+		if got := slugsOf(sortPosts(posts, tt.order)); got != tt.want {
+			t.Errorf("sortPosts(%s) = %s, want %s", tt.order, got, tt.want)
+		}
+	}
+	if got := slugsOf(posts); got != "b,c,a" {
+		t.Errorf("sortPosts modified its input: %s", got)
+	}
+}
+
+func TestSortPostsEmptyEncodesAsArray(t *testing.T) {
+	page := newPage(1, 1, 0)
+	data, err := json.Marshal(paginate(sortPosts(nil, sortNewest), page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "[]" {
+		t.Errorf("empty post list encodes as %s, want []", got)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	if order, err := parseSort("", sortNewest); order != sortNewest || err != nil {
+		t.Errorf(`parseSort("") = %q, %v`, order, err)
+	}
+	if order, err := parseSort(sortTitle, sortNewest); order != sortTitle || err != nil {
+		t.Errorf("parseSort(title) = %q, %v", order, err)
+	}
+	if _, err := parseSort("random", sortNewest); err == nil {
+		t.Error("parseSort(random) accepted an unknown order")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Post statuses. Published posts appear everywhere; scheduled posts are
+// hidden until PublishAt; unlisted posts are reachable by URL but left out of
+// listings, feeds, search and the sitemap; drafts are only reachable through
+// a preview link.
+const (
+	StatusPublished = "published"
+	StatusScheduled = "scheduled"
+	StatusUnlisted  = "unlisted"
+	StatusDraft     = "draft"
+)
+
+// previewTokenTTL is how long a preview link stays valid by default
+const previewTokenTTL = 7 * 24 * time.Hour
+
+// validStatus reports whether status is one of the known post statuses
+func validStatus(status string) bool {
+	switch status {
+	case StatusPublished, StatusScheduled, StatusUnlisted, StatusDraft:
+		return true
+	}
+	return false
+}
+
+// publishTime is when a scheduled post goes live: PublishAt, or the post
+// date when no separate time was given
+func (p Post) publishTime() time.Time {
+	if !p.PublishAt.IsZero() {
+		return p.PublishAt
+	}
+	return p.Date
+}
+
+// Listed reports whether the post appears in listings, feeds, search and
+// the sitemap at time now
+func (p Post) Listed(now time.Time) bool {
+	switch p.Status {
+	case StatusPublished, "":
+		return true
+	case StatusScheduled:
+		return !now.Before(p.publishTime())
+	}
+	return false
+}
+
+// Reachable reports whether the post can be opened by its URL at time now
+func (p Post) Reachable(now time.Time) bool {
+	return p.Status == StatusUnlisted || p.Listed(now)
+}
+
+// previewURL returns a signed link that shows the post regardless of its
+// status until the token expires
+func previewURL(slug string, ttl time.Duration) string {
+	return fmt.Sprintf("%s/preview/%s?token=%s", siteURL, url.PathEscape(slug), url.QueryEscape(signToken("preview", slug, ttl)))
+}
+
+// handlePreview serves /preview/:slug?token=, rendering any post the token
+// was issued for. Previews are never indexed.
+func handlePreview(c *gin.Context) {
+	slug := c.Param("slug")
+	subject, err := verifyToken(c.Query("token"), "preview")
+	snap := requestSnapshot(c)
+	post, found := snap.Lookup(slug)
+	if err != nil || subject != slug || !found {
+		message := "This preview link is not valid."
+		if errors.Is(err, errExpiredToken) {
+			message = "This preview link has expired. Ask the author for a new one."
+		}
+		renderPage(c, http.StatusNotFound, "not_found", map[string]interface{}{
+			"Icon":        "🔒",
+			"Title":       "Preview Unavailable",
+			"Message":     message,
+			"ButtonText":  "Browse All Posts",
+			"IsPost":      true,
+			"TITLE":       "Preview Unavailable - CodeNPixel",
+			"DESCRIPTION": "This preview link is not valid.",
+			"KEYWORDS":    "game development, graphics programming",
+			"OG_TYPE":     "website",
+			"URL":         siteURL + c.Request.URL.Path,
+			"OG_IMAGE":    siteURL + "/public/images/logo.png",
+			"ROBOTS":      "noindex, nofollow",
+		})
+		return
+	}
+
+	data := postPageData(snap, post)
+	data["Preview"] = previewNotice(post, time.Now())
+	data["ROBOTS"] = "noindex, nofollow"
+	c.Header("X-Robots-Tag", "noindex, nofollow")
+	c.Header("Cache-Control", "private, no-store")
+	renderPage(c, http.StatusOK, "post.html", data)
+}
+
+// previewNotice describes how the post will be visible once shared
+func previewNotice(post Post, now time.Time) string {
+	switch {
+	case post.Status == StatusDraft:
+		return "Draft preview. This post is not published."
+	case post.Status == StatusScheduled && !post.Listed(now):
+		return "Scheduled preview. This post goes live on " + post.publishTime().Format("Jan 2, 2006 at 15:04 MST") + "."
+	case post.Status == StatusUnlisted:
+		return "Unlisted post. Anyone with the link can read it, but it is not listed on the site."
+	}
+	return "Preview of a published post."
+}
+
+// runPreviewLinkCommand implements the "preview-link" subcommand:
+//
+//	preview-link [-ttl DURATION] SLUG
+//
+// The link is signed with SIGNING_SECRET, which must match the server's.
+func runPreviewLinkCommand(args []string) error {
+	flags := flag.NewFlagSet("preview-link", flag.ContinueOnError)
+	ttl := flags.Duration("ttl", previewTokenTTL, "how long the link stays valid")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: preview-link [-ttl DURATION] SLUG")
+	}
+	if *ttl <= 0 {
+		return errors.New("-ttl must be positive; preview links always expire")
+	}
+	if os.Getenv("SIGNING_SECRET") == "" {
+		return errors.New("SIGNING_SECRET must be set to the server's value, or the link will not verify")
+	}
+	slug := flags.Arg(0)
+
+	loaded, skipped, err := readPosts(nil)
+	if err != nil {
+		return err
+	}
+	logSkipped(skipped)
+	for _, post := range loaded {
+		if post.Slug == slug {
+			fmt.Println(previewURL(slug, *ttl))
+			return nil
+		}
+	}
+	return fmt.Errorf("no post with slug %q", slug)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContentStore holds the current posts and templates. Readers get an
+// immutable snapshot, and writers build a fresh snapshot and swap it in, so
+// handlers never need to lock and a reload never shows up halfway through a
+// request.
+type ContentStore struct {
+	mu      sync.Mutex // serialises writers
+	current atomic.Pointer[ContentSnapshot]
+}
+
+// ContentSnapshot is a read-only view of the posts and templates at one
+// point in time, with lookup indexes built once per reload. The indexes hold
+// every post; the accessors filter by status as of the call, so scheduled
+// posts appear on time without a reload.
+type ContentSnapshot struct {
+	posts      []Post
+	tmpl       *template.Template
+	bySlug     map[string]int
+	byTag      map[string][]int
+	byCategory map[string][]int
+	byAuthor   map[string][]int
+	bySeries   map[string][]int
+	authors    map[string]Author
+	tags       map[string]Term
+	categories map[string]Term
+	search     *SearchIndex
+	related    *RelatedIndex
+}
+
+// NewContentStore creates a store serving the given posts, author and
+// taxonomy registries, and templates
+func NewContentStore(posts []Post, authors []Author, taxonomy Taxonomy, tmpl *template.Template) *ContentStore {
+	s := &ContentStore{}
+	s.current.Store(newContentSnapshot(posts, authors, taxonomy, tmpl))
+	return s
+}
+
+// newContentSnapshot orders posts newest first, resolves their authors and
+// terms, indexes them by slug, tag, category, author and series, and builds the
+// full-text search and related-post indexes
+func newContentSnapshot(posts []Post, authors []Author, taxonomy Taxonomy, tmpl *template.Template) *ContentSnapshot {
+	posts = sortPosts(posts, sortNewest)
+	snap := &ContentSnapshot{
+		posts:      posts,
+		tmpl:       tmpl,
+		bySlug:     make(map[string]int, len(posts)),
+		byTag:      make(map[string][]int),
+		byCategory: make(map[string][]int),
+		byAuthor:   make(map[string][]int),
+		bySeries:   make(map[string][]int),
+		authors:    make(map[string]Author, len(authors)),
+		tags:       make(map[string]Term, len(taxonomy.Tags)),
+		categories: make(map[string]Term, len(taxonomy.Categories)),
+	}
+	snap.resolveAuthors(authors)
+	snap.resolveTerms(taxonomy)
+	snap.search = newSearchIndex(posts)
+	snap.related = newRelatedIndex(snap.search)
+	for i, post := range posts {
+		snap.bySlug[post.Slug] = i
+		for _, tag := range post.Tags {
+			key := normalizeTag(tag)
+			snap.byTag[key] = append(snap.byTag[key], i)
+		}
+		if post.Category != "" {
+			key := slugify(post.Category)
+			snap.byCategory[key] = append(snap.byCategory[key], i)
+		}
+		if post.AuthorSlug != "" {
+			snap.byAuthor[post.AuthorSlug] = append(snap.byAuthor[post.AuthorSlug], i)
+		}
+		if post.Series != "" {
+			key := slugify(post.Series)
+			snap.bySeries[key] = append(snap.bySeries[key], i)
+		}
+	}
+	return snap
+}
+
+// resolveAuthors matches each post's author against the registry by slug or
+// name, replacing it with the registered name. Authors missing from the
+// registry get a bare entry so they still have a page.
+func (c *ContentSnapshot) resolveAuthors(registry []Author) {
+	byName := make(map[string]Author, len(registry))
+	for _, author := range registry {
+		c.authors[author.Slug] = author
+		byName[strings.ToLower(author.Name)] = author
+	}
+	for i, post := range c.posts {
+		if post.Author == "" {
+			continue
+		}
+		author, ok := c.authors[slugify(post.Author)]
+		if !ok {
+			author, ok = byName[strings.ToLower(post.Author)]
+		}
+		if !ok {
+			author = Author{Slug: slugify(post.Author), Name: post.Author}
+			if existing, taken := c.authors[author.Slug]; taken {
+				author = existing
+			}
+			c.authors[author.Slug] = author
+		}
+		c.posts[i].Author, c.posts[i].AuthorSlug = author.Name, author.Slug
+	}
+}
+
+// resolveTerms registers the taxonomy and gives every tag and category used
+// by a post a term, named as first written when it isn't registered
+func (c *ContentSnapshot) resolveTerms(taxonomy Taxonomy) {
+	for _, term := range taxonomy.Tags {
+		c.tags[term.Slug] = term
+	}
+	for _, term := range taxonomy.Categories {
+		c.categories[term.Slug] = term
+	}
+	for _, post := range c.posts {
+		for _, tag := range post.Tags {
+			if slug := normalizeTag(tag); slug != "" && c.tags[slug].Slug == "" {
+				c.tags[slug] = Term{Kind: kindTag, Slug: slug, Name: tag}
+			}
+		}
+		if slug := slugify(post.Category); slug != "" && c.categories[slug].Slug == "" {
+			c.categories[slug] = Term{Kind: kindCategory, Slug: slug, Name: post.Category}
+		}
+	}
+}
+
+// Snapshot returns the current view of posts and templates
+func (s *ContentStore) Snapshot() *ContentSnapshot {
+	return s.current.Load()
+}
+
+// Templates returns the current template set
+func (s *ContentStore) Templates() *template.Template {
+	return s.Snapshot().tmpl
+}
+
+// SetPosts replaces the posts and the author and taxonomy registries, keeping
+// the current templates, and returns the previous post list
+func (s *ContentStore) SetPosts(posts []Post, authors []Author, taxonomy Taxonomy) []Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.current.Load()
+	s.current.Store(newContentSnapshot(posts, authors, taxonomy, old.tmpl))
+	return old.posts
+}
+
+// SetTemplates replaces the templates, keeping the current posts
+func (s *ContentStore) SetTemplates(tmpl *template.Template) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.current.Load()
+	next := *old
+	next.tmpl = tmpl
+	s.current.Store(&next)
+}
+
+// Posts returns the listed posts, newest first
+func (c *ContentSnapshot) Posts() []Post {
+	now := time.Now()
+	out := make([]Post, 0, len(c.posts))
+	for _, post := range c.posts {
+		if post.Listed(now) {
+			out = append(out, post)
+		}
+	}
+	return out
+}
+
+// NextPublish returns when the next scheduled post goes live after now, or
+// the zero time when none is waiting
+func (c *ContentSnapshot) NextPublish(now time.Time) time.Time {
+	var next time.Time
+	for _, post := range c.posts {
+		if at := post.publishTime(); post.Status == StatusScheduled && at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+// AllPosts returns every post whatever its status, newest first. The slice
+// is shared between readers and must not be modified.
+func (c *ContentSnapshot) AllPosts() []Post {
+	return c.posts
+}
+
+// Templates returns the template set of this snapshot
+func (c *ContentSnapshot) Templates() *template.Template {
+	return c.tmpl
+}
+
+// Post looks up a post that can be opened by URL, which includes unlisted
+// posts
+func (c *ContentSnapshot) Post(slug string) (Post, bool) {
+	post, ok := c.Lookup(slug)
+	if !ok || !post.Reachable(time.Now()) {
+		return Post{}, false
+	}
+	return post, true
+}
+
+// Lookup finds a post by slug whatever its status, for previews
+func (c *ContentSnapshot) Lookup(slug string) (Post, bool) {
+	i, ok := c.bySlug[slug]
+	if !ok {
+		return Post{}, false
+	}
+	return c.posts[i], true
+}
+
+// PostsByTag returns the listed posts carrying tag, compared by slug
+func (c *ContentSnapshot) PostsByTag(tag string) []Post {
+	return c.collect(c.byTag[normalizeTag(tag)])
+}
+
+// PostsByAuthor returns the listed posts by the author with slug
+func (c *ContentSnapshot) PostsByAuthor(slug string) []Post {
+	return c.collect(c.byAuthor[slugify(slug)])
+}
+
+// Author looks up an author by slug
+func (c *ContentSnapshot) Author(slug string) (Author, bool) {
+	author, ok := c.authors[slugify(slug)]
+	return author, ok
+}
+
+// Authors returns the slugs of every author with a listed post, sorted
+// alphabetically
+func (c *ContentSnapshot) Authors() []string {
+	return c.listedKeys(c.byAuthor)
+}
+
+// PostsByCategory returns the listed posts in category, compared by slug
+func (c *ContentSnapshot) PostsByCategory(category string) []Post {
+	return c.collect(c.byCategory[slugify(category)])
+}
+
+// Tag looks up the term for a tag in any spelling
+func (c *ContentSnapshot) Tag(tag string) (Term, bool) {
+	term, ok := c.tags[normalizeTag(tag)]
+	return term, ok
+}
+
+// Category looks up the term for a category in any spelling
+func (c *ContentSnapshot) Category(category string) (Term, bool) {
+	term, ok := c.categories[slugify(category)]
+	return term, ok
+}
+
+// TagTerms returns the terms for a post's tags, in the post's order
+func (c *ContentSnapshot) TagTerms(tags []string) []Term {
+	terms := make([]Term, 0, len(tags))
+	for _, tag := range tags {
+		if term, ok := c.Tag(tag); ok {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Series returns the series with slug and its listed parts in reading
+// order. A series with no listed part does not exist yet.
+func (c *ContentSnapshot) Series(slug string) (Series, bool) {
+	posts := c.collect(c.bySeries[strings.ToLower(slug)])
+	if len(posts) == 0 {
+		return Series{}, false
+	}
+	seriesOrder(posts)
+	return Series{Slug: strings.ToLower(slug), Title: posts[0].Series, Posts: posts}, true
+}
+
+// SeriesSlugs returns the slugs of every series with a listed part, sorted
+// alphabetically
+func (c *ContentSnapshot) SeriesSlugs() []string {
+	return c.listedKeys(c.bySeries)
+}
+
+// Search runs a full-text query against the snapshot's listed posts
+func (c *ContentSnapshot) Search(query string) []SearchResult {
+	now := time.Now()
+	results := c.search.Search(query)
+	out := results[:0]
+	for _, r := range results {
+		if r.Post.Listed(now) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Tags returns the slug of every tag used by a listed post, sorted
+// alphabetically
+func (c *ContentSnapshot) Tags() []string {
+	return c.listedKeys(c.byTag)
+}
+
+// Categories returns the slug of every category used by a listed post,
+// sorted alphabetically
+func (c *ContentSnapshot) Categories() []string {
+	return c.listedKeys(c.byCategory)
+}
+
+// collect returns the listed posts among indexes
+func (c *ContentSnapshot) collect(indexes []int) []Post {
+	now := time.Now()
+	out := make([]Post, 0, len(indexes))
+	for _, idx := range indexes {
+		if c.posts[idx].Listed(now) {
+			out = append(out, c.posts[idx])
+		}
+	}
+	return out
+}
+
+// listedKeys returns the sorted keys of index that have a listed post
+func (c *ContentSnapshot) listedKeys(index map[string][]int) []string {
+	now := time.Now()
+	keys := make([]string, 0, len(index))
+	for key, indexes := range index {
+		for _, idx := range indexes {
+			if c.posts[idx].Listed(now) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeTag returns the slug identifying tag, ignoring case,
+// punctuation and the literal quote characters older posts.json tags carry
+func normalizeTag(tag string) string {
+	return slugify(tag)
+}
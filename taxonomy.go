@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// taxonomyFile is the hand-maintained tag and category registry
+const taxonomyFile = "taxonomy.json"
+
+// Taxonomy kinds, which are also the first segment of a term's URL
+const (
+	kindTag      = "tag"
+	kindCategory = "category"
+)
+
+// defaultTermIcon is shown for posts whose primary tag has no icon
+const defaultTermIcon = "🔥"
+
+// Term is a tag or category. Posts refer to terms by name in any spelling;
+// the slug identifies them.
+type Term struct {
+	Kind        string `json:"-"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+// Path returns the site-relative address of the term page
+func (t Term) Path() string {
+	return fmt.Sprintf("/%s/%s", t.Kind, url.PathEscape(t.Slug))
+}
+
+// URL returns the term page address
+func (t Term) URL() string {
+	return siteURL + t.Path()
+}
+
+// Taxonomy is the registry of known tags and categories
+type Taxonomy struct {
+	Tags       []Term `json:"tags"`
+	Categories []Term `json:"categories"`
+}
+
+// loadTaxonomy reads the tag and category registry. A missing file is not an
+// error, as terms are also derived from the posts themselves.
+func loadTaxonomy(path string) (Taxonomy, error) {
+	var taxonomy Taxonomy
+	data, err := fs.ReadFile(siteFS, path)
+	if os.IsNotExist(err) {
+		return taxonomy, nil
+	}
+	if err != nil {
+		return taxonomy, err
+	}
+	if err := json.Unmarshal(data, &taxonomy); err != nil {
+		return taxonomy, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, list := range []struct {
+		kind  string
+		terms []Term
+	}{{kindTag, taxonomy.Tags}, {kindCategory, taxonomy.Categories}} {
+		seen := map[string]bool{}
+		for i, term := range list.terms {
+			if term.Name == "" {
+				return taxonomy, fmt.Errorf("%s: %s %d has no name", path, list.kind, i+1)
+			}
+			list.terms[i].Kind = list.kind
+			list.terms[i].Slug = slugify(term.Slug)
+			if term.Slug == "" {
+				list.terms[i].Slug = slugify(term.Name)
+			}
+			if seen[list.terms[i].Slug] {
+				return taxonomy, fmt.Errorf("%s: duplicate %s slug %q", path, list.kind, list.terms[i].Slug)
+			}
+			seen[list.terms[i].Slug] = true
+		}
+	}
+	return taxonomy, nil
+}
+
+// termSpelling folds case and word separators, so "Game Dev" and game-dev
+// are spellings of the same term
+func termSpelling(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' || r == '_' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// termCollisions reports a tag or category name that shares its slug with a
+// different name, registered or used first, instead of merging both onto one
+// page
+func termCollisions(posts []Post, taxonomy Taxonomy) error {
+	type claim struct {
+		name      string
+		spellings map[string]bool
+	}
+	claims := map[string]map[string]*claim{kindTag: {}, kindCategory: {}}
+	claimSlug := func(kind, slug, name string) *claim {
+		c, ok := claims[kind][slug]
+		if !ok {
+			c = &claim{name: name, spellings: map[string]bool{termSpelling(slug): true, termSpelling(name): true}}
+			claims[kind][slug] = c
+		}
+		return c
+	}
+	for _, term := range taxonomy.Tags {
+		claimSlug(kindTag, term.Slug, term.Name)
+	}
+	for _, term := range taxonomy.Categories {
+		claimSlug(kindCategory, term.Slug, term.Name)
+	}
+	for _, post := range posts {
+		names := map[string][]string{kindTag: post.Tags, kindCategory: {post.Category}}
+		for _, kind := range []string{kindTag, kindCategory} {
+			for _, name := range names[kind] {
+				slug := slugify(name)
+				if slug == "" {
+					continue
+				}
+				if c := claimSlug(kind, slug, name); !c.spellings[termSpelling(name)] {
+					return fmt.Errorf("post %q: %s %q has the same slug %q as %q; rename one of them", post.Slug, kind, name, slug, c.name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// termCount is a term with the number of listed posts using it
+type termCount struct {
+	Term
+	Count int
+}
+
+// termCounts pairs each slug with its term and post count, most used first
+func termCounts(slugs []string, lookup func(string) (Term, bool), posts func(string) []Post) []termCount {
+	out := make([]termCount, 0, len(slugs))
+	for _, slug := range slugs {
+		term, _ := lookup(slug)
+		out = append(out, termCount{Term: term, Count: len(posts(slug))})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
+
+// termPageData prepares taxonomy.html data for one page of a term's posts
+func termPageData(snap *ContentSnapshot, term Term, posts []Post, number int) map[string]interface{} {
+	page := newPage(number, postsPerPage, len(posts))
+	heading := "#" + term.Name
+	title := fmt.Sprintf(`Posts tagged with "%s" - CodeNPixel`, term.Name)
+	description := fmt.Sprintf(`Explore posts tagged with "%s" on game development and graphics programming at CodeNPixel.`, term.Name)
+	if term.Kind == kindCategory {
+		heading = term.Name
+		title = fmt.Sprintf("%s Posts - CodeNPixel", term.Name)
+		description = fmt.Sprintf("Explore %s posts on game development and graphics programming at CodeNPixel.", term.Name)
+	}
+	if term.Description != "" {
+		description = term.Description
+	}
+	if page.Number > 1 {
+		title = strings.Replace(title, " - CodeNPixel", fmt.Sprintf(" - Page %d - CodeNPixel", page.Number), 1)
+	}
+
+	data := map[string]interface{}{
+		"Term":        term,
+		"Heading":     heading,
+		"Posts":       postCardsData(snap, paginate(posts, page)),
+		"Page":        page,
+		"TITLE":       title,
+		"DESCRIPTION": description,
+		"KEYWORDS":    "game development, graphics programming, " + term.Name,
+		"OG_TYPE":     "website",
+		"URL":         term.URL(),
+		"OG_IMAGE":    siteURL + "/public/images/logo.png",
+		"JSON_LD": map[string]interface{}{
+			"@context":    "https://schema.org",
+			"@type":       "CollectionPage",
+			"name":        term.Name,
+			"description": description,
+			"url":         term.URL(),
+		},
+	}
+	if page.HasPrev() {
+		data["PrevURL"] = term.Path()
+		if page.Prev() > 1 {
+			data["PrevURL"] = fmt.Sprintf("%s?page=%d", term.Path(), page.Prev())
+		}
+	}
+	if page.HasNext() {
+		data["NextURL"] = fmt.Sprintf("%s?page=%d", term.Path(), page.Next())
+	}
+	return data
+}
+
+// termHandler serves /tag/:slug or /category/:slug with the term's posts
+func termHandler(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snap := requestSnapshot(c)
+		lookup, list := snap.Tag, snap.PostsByTag
+		if kind == kindCategory {
+			lookup, list = snap.Category, snap.PostsByCategory
+		}
+		term, ok := lookup(c.Param("slug"))
+		posts := list(c.Param("slug"))
+		number, _, err := parsePage(c, postsPerPage, postsPerPage)
+		if !ok || len(posts) == 0 || err != nil {
+			renderPage(c, http.StatusNotFound, "not_found", map[string]interface{}{
+				"Icon":        "🏷️",
+				"Title":       "Nothing Here Yet",
+				"Message":     fmt.Sprintf("We couldn't find any posts in that %s.", kind),
+				"ButtonText":  "Browse All Posts",
+				"IsPost":      true,
+				"TITLE":       "Not Found - CodeNPixel",
+				"DESCRIPTION": fmt.Sprintf("The requested %s was not found.", kind),
+				"KEYWORDS":    "game development, graphics programming",
+				"OG_TYPE":     "website",
+				"URL":         siteURL + c.Request.URL.Path,
+				"OG_IMAGE":    siteURL + "/public/images/logo.png",
+			})
+			return
+		}
+
+		data := termPageData(snap, term, posts, number)
+		if c.GetHeader("HX-Target") == "load-more" {
+			content, err := renderTemplate(snap.Templates(), "posts_page", data)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error loading posts")
+				return
+			}
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
+			return
+		}
+		renderPage(c, http.StatusOK, "taxonomy.html", data)
+	}
+}
+
+// handleTags serves /tags, every tag and category with its post count
+func handleTags(c *gin.Context) {
+	snap := requestSnapshot(c)
+	renderPage(c, http.StatusOK, "tags.html", map[string]interface{}{
+		"Tags":        termCounts(snap.Tags(), snap.Tag, snap.PostsByTag),
+		"Categories":  termCounts(snap.Categories(), snap.Category, snap.PostsByCategory),
+		"TITLE":       "Tags - CodeNPixel",
+		"DESCRIPTION": "Browse CodeNPixel articles on game development and graphics programming by tag and category.",
+		"KEYWORDS":    "game development, graphics programming, tags, categories",
+		"OG_TYPE":     "website",
+		"URL":         siteURL + "/tags",
+		"OG_IMAGE":    siteURL + "/public/images/logo.png",
+	})
+}
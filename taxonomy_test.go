@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTermCollisions(t *testing.T) {
+	taxonomy := Taxonomy{
+		Tags:       []Term{{Kind: kindTag, Slug: "opengl", Name: "OpenGL"}},
+		Categories: []Term{{Kind: kindCategory, Slug: "gamedev", Name: "Game Development"}},
+	}
+	tests := []struct {
+		name    string
+		posts   []Post
+		wantErr string
+	}{
+		{
+			name: "spellings of one term",
+			posts: []Post{
+				{Slug: "a", Tags: []string{"Game Dev", "opengl"}, Category: "Game Development"},
+				{Slug: "b", Tags: []string{"game-dev", "OpenGL"}, Category: "gamedev"},
+				{Slug: "c", Tags: []string{"game_dev"}},
+			},
+		},
+		{
+			name:  "symbols keep languages apart",
+			posts: []Post{{Slug: "a", Tags: []string{"C", "C++", "C#"}}},
+		},
+		{
+			name: "two names on one slug",
+			posts: []Post{
+				{Slug: "a", Tags: []string{"C"}},
+				{Slug: "b", Tags: []string{"C!"}},
+			},
+			wantErr: `post "b": tag "C!" has the same slug "c" as "C"`,
+		},
+		{
+			name:    "name clashing with the registry",
+			posts:   []Post{{Slug: "a", Tags: []string{"OpenGL?"}}},
+			wantErr: `post "a": tag "OpenGL?" has the same slug "opengl" as "OpenGL"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := termCollisions(tt.posts, taxonomy)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("termCollisions() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("termCollisions() = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Table of contents layouts. Inline puts the contents above the post body;
+// sidebar keeps them in a sticky column beside it on wide screens.
+const (
+	TOCInline  = "inline"
+	TOCSidebar = "sidebar"
+	TOCNone    = "none"
+)
+
+// tocLayout is the layout used by posts that don't choose one
+var tocLayout = envOr("TOC_LAYOUT", TOCInline)
+
+// tocMinHeadings is the fewest headings worth a table of contents
+const tocMinHeadings = 3
+
+// validTOC reports whether layout is a known table of contents layout, or
+// empty for the site default
+func validTOC(layout string) bool {
+	switch layout {
+	case "", TOCInline, TOCSidebar, TOCNone:
+		return true
+	}
+	return false
+}
+
+// TOCEntry is one heading in the table of contents. h3 headings nest under
+// the h2 before them.
+type TOCEntry struct {
+	ID       string
+	Title    string
+	Children []TOCEntry
+}
+
+// buildTOC collects the h2 and h3 headings of a rendered post body.
+// Headings without an id can't be linked to and are skipped. It returns the
+// nested entries and the number of headings found.
+func buildTOC(content string) ([]TOCEntry, int) {
+	z := html.NewTokenizer(strings.NewReader(content))
+	var entries []TOCEntry
+	var text strings.Builder
+	// level and id describe the heading being read, if any
+	var level, id string
+	count := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return entries, count
+		case html.StartTagToken:
+			name, hasAttr := z.TagName()
+			if level != "" || (string(name) != "h2" && string(name) != "h3") {
+				continue
+			}
+			for id = ""; hasAttr; {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "id" {
+					id = string(val)
+				}
+			}
+			if id != "" {
+				level = string(name)
+				text.Reset()
+			}
+		case html.TextToken:
+			if level != "" {
+				text.Write(z.Text())
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); level == "" || string(name) != level {
+				continue
+			}
+			entry := TOCEntry{ID: id, Title: strings.Join(strings.Fields(text.String()), " ")}
+			if level == "h3" && len(entries) > 0 {
+				parent := &entries[len(entries)-1]
+				parent.Children = append(parent.Children, entry)
+			} else {
+				entries = append(entries, entry)
+			}
+			level = ""
+			count++
+		}
+	}
+}
+
+// postTOC returns the table of contents layout and entries for a post, or
+// TOCNone when the post is too short to need one
+func postTOC(post Post, content string) (string, []TOCEntry) {
+	layout := post.TOC
+	if layout == "" {
+		layout = tocLayout
+	}
+	if layout == TOCNone {
+		return TOCNone, nil
+	}
+	entries, count := buildTOC(content)
+	if count < tocMinHeadings {
+		return TOCNone, nil
+	}
+	return layout, entries
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerifyToken(t *testing.T) {
+	valid := signToken("confirm", "reader@example.com", time.Hour)
+	encoded, sig, _ := strings.Cut(valid, ".")
+	forged, _, _ := strings.Cut(signToken("confirm", "attacker@example.com", time.Hour), ".")
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		want    string
+		wantErr error
+	}{
+		{"valid", valid, "confirm", "reader@example.com", nil},
+		{"never expires", signToken("manage", "reader@example.com", 0), "manage", "reader@example.com", nil},
+		{"expired", signToken("confirm", "reader@example.com", -time.Minute), "confirm", "", errExpiredToken},
+		{"wrong purpose", valid, "manage", "", errInvalidToken},
+		{"tampered payload", forged + "." + sig, "confirm", "", errInvalidToken},
+		{"tampered signature", encoded + "." + strings.Repeat("A", len(sig)), "confirm", "", errInvalidToken},
+		{"no signature", encoded, "confirm", "", errInvalidToken},
+		{"empty", "", "confirm", "", errInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyToken(tt.token, tt.purpose)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("verifyToken() = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPreviewLinkRequiresExpiry(t *testing.T) {
+	t.Setenv("SIGNING_SECRET", "test-secret")
+	for _, ttl := range []string{"0", "-1h"} {
+		err := runPreviewLinkCommand([]string{"-ttl", ttl, "some-post"})
+		if err == nil || !strings.Contains(err.Error(), "-ttl") {
+			t.Errorf("preview-link -ttl %s: error = %v, want a -ttl error", ttl, err)
+		}
+	}
+}